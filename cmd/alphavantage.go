@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// providerAlphaVantage is the PROVIDER value for Alpha Vantage
+const providerAlphaVantage = "alphavantage"
+
+// alphaVantageBaseURL is the Alpha Vantage query endpoint
+const alphaVantageBaseURL = "https://www.alphavantage.co/query"
+
+// alphaVantageCompactDays is how many trading days the default compact
+// output holds. Longer requests ask for the full history instead.
+const alphaVantageCompactDays = 100
+
+// alphaVantageRateLimits is the free tier quota for an Alpha Vantage key
+var alphaVantageRateLimits = RateLimits{PerMinute: 5, PerDay: 25}
+
+// AlphaVantageResponse is the format returned by the Alpha Vantage API
+type AlphaVantageResponse struct {
+	MetaData   map[string]interface{}     `json:"Meta Data"`
+	TimeSeries map[string]alphaVantageBar `json:"Time Series (Daily)"`
+
+	// Alpha Vantage answers throttled or invalid calls with HTTP 200 and
+	// one of these messages instead of a time series
+	Note         string `json:"Note,omitempty"`
+	Information  string `json:"Information,omitempty"`
+	ErrorMessage string `json:"Error Message,omitempty"`
+}
+
+// alphaVantageBar is one day of an Alpha Vantage daily time series
+type alphaVantageBar struct {
+	Open   alphaVantageValue `json:"1. open"`
+	High   alphaVantageValue `json:"2. high"`
+	Low    alphaVantageValue `json:"3. low"`
+	Close  alphaVantageValue `json:"4. close"`
+	Volume alphaVantageValue `json:"5. volume"`
+}
+
+// alphaVantageValue is one field of an alphaVantageBar. Alpha Vantage sends
+// numbers as strings; anything else is kept as raw JSON so that validation
+// can report it rather than failing the whole response.
+type alphaVantageValue string
+
+// UnmarshalJSON implements json.Unmarshaler
+func (v *alphaVantageValue) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		s = string(data)
+	}
+	*v = alphaVantageValue(s)
+	return nil
+}
+
+// AlphaVantageProvider fetches daily bars from the Alpha Vantage API
+type AlphaVantageProvider struct {
+	APIKey Secret
+	// KeyFile, when set, supplies the key in place of APIKey
+	KeyFile *SecretFile
+	BaseURL string
+	Client  HTTPClient
+}
+
+// newAlphaVantageProvider is the ProviderFactory for Alpha Vantage
+func newAlphaVantageProvider(config *Config, client HTTPClient) Provider {
+	provider := &AlphaVantageProvider{
+		APIKey:  config.APIKey,
+		BaseURL: alphaVantageBaseURL,
+		Client:  client,
+	}
+	if config.APIKeyFile != "" {
+		provider.KeyFile = NewSecretFile(config.APIKeyFile, config.APIKey, config.SecretRefresh)
+	}
+	return provider
+}
+
+// Name implements the Provider interface
+func (p *AlphaVantageProvider) Name() string {
+	return providerAlphaVantage
+}
+
+// DailyBars implements the Provider interface. Errors from the HTTP client
+// quote the request URL, so the API key is redacted from all of them.
+func (p *AlphaVantageProvider) DailyBars(ctx context.Context, symbol string, nDays int) (bars []TimeSeriesData, err error) {
+	apiKey := p.apiKey()
+	defer func() {
+		err = redactError(err, newRedactor([]string{apiKey.Reveal()}))
+	}()
+
+	resp, err := p.Client.Get(ctx, p.queryURL(symbol, nDays, apiKey))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := resp.Body.Close(); cerr != nil && err == nil {
+			err = fmt.Errorf("error closing response body: %v", cerr)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: unexpected HTTP status %d", ErrUpstream, resp.StatusCode)
+	}
+
+	var avResp AlphaVantageResponse
+	if err := json.NewDecoder(resp.Body).Decode(&avResp); err != nil {
+		return nil, fmt.Errorf("error decoding response: %v", err)
+	}
+
+	if err := avResp.err(); err != nil {
+		return nil, err
+	}
+
+	if avResp.TimeSeries == nil {
+		return nil, fmt.Errorf("no time series data returned")
+	}
+
+	return parseAlphaVantageSeries(avResp.TimeSeries), nil
+}
+
+// err converts an Alpha Vantage error payload into a typed error, or
+// returns nil if the response carries none
+func (r *AlphaVantageResponse) err() error {
+	switch {
+	case r.ErrorMessage != "":
+		if mentionsAPIKey(r.ErrorMessage) {
+			return fmt.Errorf("%w: %s", ErrInvalidAPIKey, r.ErrorMessage)
+		}
+		return fmt.Errorf("%w: %s", ErrInvalidSymbol, r.ErrorMessage)
+	case r.Information != "":
+		if mentionsRateLimit(r.Information) {
+			return fmt.Errorf("%w: %s", ErrRateLimited, r.Information)
+		}
+		if mentionsAPIKey(r.Information) {
+			return fmt.Errorf("%w: %s", ErrInvalidAPIKey, r.Information)
+		}
+		return fmt.Errorf("%w: %s", ErrUpstream, r.Information)
+	case r.Note != "":
+		return fmt.Errorf("%w: %s", ErrRateLimited, r.Note)
+	}
+	return nil
+}
+
+// mentionsAPIKey reports whether an Alpha Vantage message is about the key
+func mentionsAPIKey(message string) bool {
+	message = strings.ToLower(message)
+	return strings.Contains(message, "apikey") || strings.Contains(message, "api key")
+}
+
+// mentionsRateLimit reports whether an Alpha Vantage message is a throttle notice
+func mentionsRateLimit(message string) bool {
+	message = strings.ToLower(message)
+	return strings.Contains(message, "rate limit") || strings.Contains(message, "call frequency")
+}
+
+// alphaVantageThrottled is the ThrottleDetector for Alpha Vantage. Only
+// per-minute throttling is worth retrying; the daily quota will not recover
+// within a retry window.
+func alphaVantageThrottled(body []byte) bool {
+	if !bytes.Contains(body, []byte(`"Note"`)) && !bytes.Contains(body, []byte(`"Information"`)) {
+		return false
+	}
+
+	var avResp AlphaVantageResponse
+	if err := json.Unmarshal(body, &avResp); err != nil {
+		return false
+	}
+
+	message := strings.ToLower(avResp.Note + " " + avResp.Information)
+	return strings.Contains(message, "per minute") || strings.Contains(message, "call frequency")
+}
+
+// apiKey returns the key to send with the next call
+func (p *AlphaVantageProvider) apiKey() Secret {
+	if p.KeyFile != nil {
+		return p.KeyFile.Secret()
+	}
+	return p.APIKey
+}
+
+// queryURL builds the TIME_SERIES_DAILY request URL for symbol, asking for
+// the full history when nDays is more than the compact output holds
+func (p *AlphaVantageProvider) queryURL(symbol string, nDays int, apiKey Secret) string {
+	baseURL := p.BaseURL
+	if baseURL == "" {
+		baseURL = alphaVantageBaseURL
+	}
+
+	params := url.Values{}
+	params.Set("apikey", apiKey.Reveal())
+	params.Set("function", "TIME_SERIES_DAILY")
+	params.Set("symbol", symbol)
+	if nDays > alphaVantageCompactDays {
+		params.Set("outputsize", "full")
+	}
+	return baseURL + "?" + params.Encode()
+}
+
+// parseAlphaVantageSeries converts the Alpha Vantage time series into
+// bars. Days with a malformed date or a missing or malformed value are
+// marked Invalid, with a warning for each bad field.
+func parseAlphaVantageSeries(timeSeries map[string]alphaVantageBar) []TimeSeriesData {
+	bars := make([]TimeSeriesData, 0, len(timeSeries))
+	for date, day := range timeSeries {
+		bars = append(bars, day.decode(date))
+	}
+	return bars
+}
+
+// decode validates the date and every field of the bar for it. A bar whose
+// values all parse but contradict each other, such as a high below the low,
+// is kept with warnings saying so.
+func (b alphaVantageBar) decode(date string) TimeSeriesData {
+	bar := TimeSeriesData{Date: date}
+	if _, err := parseTradingDate(date); err != nil {
+		bar.invalidate(fmt.Sprintf("invalid date %q", date))
+	}
+	bar.OpenPrice = parseAlphaVantagePrice(&bar, "open", b.Open)
+	bar.HighPrice = parseAlphaVantagePrice(&bar, "high", b.High)
+	bar.LowPrice = parseAlphaVantagePrice(&bar, "low", b.Low)
+	bar.ClosePrice = parseAlphaVantagePrice(&bar, "close", b.Close)
+
+	volume, err := strconv.ParseInt(string(b.Volume), 10, 64)
+	switch {
+	case b.Volume == "":
+		bar.invalidate("missing volume")
+	case err != nil || volume < 0:
+		bar.invalidate(fmt.Sprintf("invalid volume %q", b.Volume))
+	default:
+		bar.Volume = volume
+	}
+
+	if bar.Invalid {
+		return bar
+	}
+	if bar.HighPrice < bar.LowPrice {
+		bar.Warnings = append(bar.Warnings, fmt.Sprintf("high %v is below low %v", bar.HighPrice, bar.LowPrice))
+	}
+	for _, field := range []struct {
+		name  string
+		price Price
+	}{{"open", bar.OpenPrice}, {"close", bar.ClosePrice}} {
+		if field.price < bar.LowPrice || field.price > bar.HighPrice {
+			bar.Warnings = append(bar.Warnings, fmt.Sprintf("%s %v is outside the day's range %v to %v", field.name, field.price, bar.LowPrice, bar.HighPrice))
+		}
+	}
+	return bar
+}
+
+// parseAlphaVantagePrice parses the named price field, invalidating bar
+// when it is missing, malformed or not a positive number
+func parseAlphaVantagePrice(bar *TimeSeriesData, name string, value alphaVantageValue) Price {
+	if value == "" {
+		bar.invalidate("missing " + name)
+		return 0
+	}
+	price, err := parsePrice(string(value))
+	if err != nil || price <= 0 {
+		bar.invalidate(fmt.Sprintf("invalid %s %q", name, value))
+		return 0
+	}
+	return price
+}
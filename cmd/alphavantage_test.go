@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestAlphaVantageQueryURL(t *testing.T) {
+	var requested string
+	provider := &AlphaVantageProvider{
+		APIKey: "test-api-key",
+		Client: &MockHTTPClient{
+			DoFunc: func(ctx context.Context, rawURL string) (*http.Response, error) {
+				requested = rawURL
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       io.NopCloser(bytes.NewBufferString(`{"Time Series (Daily)": {}}`)),
+				}, nil
+			},
+		},
+	}
+
+	if _, err := provider.DailyBars(context.Background(), "BRK.B", 5); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	parsed, err := url.Parse(requested)
+	if err != nil {
+		t.Fatalf("Failed to parse requested URL: %v", err)
+	}
+	if got := parsed.Scheme + "://" + parsed.Host + parsed.Path; got != alphaVantageBaseURL {
+		t.Errorf("Expected base URL %s, got %s", alphaVantageBaseURL, got)
+	}
+
+	query := parsed.Query()
+	expected := map[string]string{
+		"apikey":   "test-api-key",
+		"function": "TIME_SERIES_DAILY",
+		"symbol":   "BRK.B",
+	}
+	for key, value := range expected {
+		if query.Get(key) != value {
+			t.Errorf("Expected %s=%s, got %s", key, value, query.Get(key))
+		}
+	}
+
+	tests := []struct {
+		nDays      int
+		outputSize string
+	}{
+		{5, ""},
+		{alphaVantageCompactDays, ""},
+		{alphaVantageCompactDays + 1, "full"},
+		{1000, "full"},
+	}
+	for _, tt := range tests {
+		parsed, err := url.Parse(provider.queryURL("IBM", tt.nDays, provider.APIKey))
+		if err != nil {
+			t.Fatalf("Failed to parse query URL: %v", err)
+		}
+		if got := parsed.Query().Get("outputsize"); got != tt.outputSize {
+			t.Errorf("Expected outputsize %q for %d days, got %q", tt.outputSize, tt.nDays, got)
+		}
+	}
+}
+
+func TestAlphaVantageBarDecode(t *testing.T) {
+	valid := alphaVantageBar{Open: "234.50", High: "236.80", Low: "233.20", Close: "235.60", Volume: "45000000"}
+
+	tests := []struct {
+		name     string
+		bar      alphaVantageBar
+		expected TimeSeriesData
+	}{
+		{
+			name: "Valid bar",
+			bar:  valid,
+			expected: TimeSeriesData{
+				Date: "2025-01-15", OpenPrice: testPrice("234.50"), HighPrice: testPrice("236.80"), LowPrice: testPrice("233.20"), ClosePrice: testPrice("235.60"), Volume: 45000000,
+			},
+		},
+		{
+			name: "Malformed close",
+			bar:  alphaVantageBar{Open: "234.50", High: "236.80", Low: "233.20", Close: "invalid", Volume: "45000000"},
+			expected: TimeSeriesData{
+				Date: "2025-01-15", OpenPrice: testPrice("234.50"), HighPrice: testPrice("236.80"), LowPrice: testPrice("233.20"), Volume: 45000000,
+				Warnings: []string{`invalid close "invalid"`}, Invalid: true,
+			},
+		},
+		{
+			name: "Every bad field is reported",
+			bar:  alphaVantageBar{Open: "230.50", High: "-1", Low: "NaN", Volume: "12.5"},
+			expected: TimeSeriesData{
+				Date: "2025-01-15", OpenPrice: testPrice("230.50"),
+				Warnings: []string{`invalid high "-1"`, `invalid low "NaN"`, "missing close", `invalid volume "12.5"`},
+				Invalid:  true,
+			},
+		},
+		{
+			name: "Inconsistent prices are flagged",
+			bar:  alphaVantageBar{Open: "240.00", High: "233.20", Low: "236.80", Close: "235.60", Volume: "0"},
+			expected: TimeSeriesData{
+				Date: "2025-01-15", OpenPrice: testPrice("240"), HighPrice: testPrice("233.20"), LowPrice: testPrice("236.80"), ClosePrice: testPrice("235.60"),
+				Warnings: []string{
+					"high 233.2 is below low 236.8",
+					"open 240 is outside the day's range 236.8 to 233.2",
+					"close 235.6 is outside the day's range 236.8 to 233.2",
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if bar := tt.bar.decode("2025-01-15"); !reflect.DeepEqual(bar, tt.expected) {
+				t.Errorf("Expected bar %+v, got %+v", tt.expected, bar)
+			}
+		})
+	}
+}
+
+func TestAlphaVantageBarUnmarshal(t *testing.T) {
+	body := `{"1. open": 234.5, "2. high": "236.80", "3. low": true, "4. close": null}`
+
+	var bar alphaVantageBar
+	if err := json.Unmarshal([]byte(body), &bar); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := alphaVantageBar{Open: "234.5", High: "236.80", Low: "true"}
+	if bar != expected {
+		t.Errorf("Expected %+v, got %+v", expected, bar)
+	}
+}
+
+func TestAlphaVantageDropsInvalidDays(t *testing.T) {
+	body := `{"Time Series (Daily)": {
+		"2025-01-15": {"1. open": "234.50", "2. high": "236.80", "3. low": "233.20", "4. close": "235.60", "5. volume": "45000000"},
+		"2025-01-14": {"1. open": "232.50", "2. high": "234.80", "3. low": "231.20", "4. close": "", "5. volume": "43000000"},
+		"2025-01-13": {"1. open": "230.50", "2. high": "232.80", "3. low": "229.20", "4. close": "231.60", "5. volume": "41000000"},
+		"2025-01-10": {"1. open": "oops", "2. high": "230.80", "3. low": "227.20", "4. close": "229.60", "5. volume": "40000000"}
+	}}`
+	provider := &AlphaVantageProvider{
+		APIKey: "test-api-key",
+		Client: &MockHTTPClient{
+			DoFunc: func(ctx context.Context, rawURL string) (*http.Response, error) {
+				return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString(body))}, nil
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		nDays    int
+		dates    []string
+		warnings []string
+	}{
+		{
+			name:     "Dropped day within the window",
+			nDays:    2,
+			dates:    []string{"2025-01-15", "2025-01-13"},
+			warnings: []string{"2025-01-14 dropped: missing close"},
+		},
+		{
+			name:  "Dropped days before the window are not reported",
+			nDays: 1,
+			dates: []string{"2025-01-15"},
+		},
+		{
+			name:     "Short history reports every dropped day",
+			nDays:    5,
+			dates:    []string{"2025-01-15", "2025-01-13"},
+			warnings: []string{"2025-01-14 dropped: missing close", `2025-01-10 dropped: invalid open "oops"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := fetchStockData(context.Background(), provider, stockQuery{Symbol: "AAPL", Days: tt.nDays, Order: OrderDescending})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			dates := make([]string, len(response.Data))
+			for i, day := range response.Data {
+				dates[i] = day.Date
+			}
+			if !reflect.DeepEqual(dates, tt.dates) {
+				t.Errorf("Expected dates %v, got %v", tt.dates, dates)
+			}
+			if !reflect.DeepEqual(response.Warnings, tt.warnings) {
+				t.Errorf("Expected warnings %q, got %q", tt.warnings, response.Warnings)
+			}
+		})
+	}
+}
+
+func TestAlphaVantageDropsMalformedDates(t *testing.T) {
+	body := `{"Time Series (Daily)": {
+		"2025-01-15": {"1. open": "234.50", "2. high": "236.80", "3. low": "233.20", "4. close": "235.60", "5. volume": "45000000"},
+		"2025-13-45": {"1. open": "232.50", "2. high": "234.80", "3. low": "231.20", "4. close": "233.60", "5. volume": "43000000"},
+		"2025-01-13": {"1. open": "230.50", "2. high": "232.80", "3. low": "229.20", "4. close": "231.60", "5. volume": "41000000"}
+	}}`
+	provider := &AlphaVantageProvider{
+		APIKey: "test-api-key",
+		Client: &MockHTTPClient{
+			DoFunc: func(ctx context.Context, rawURL string) (*http.Response, error) {
+				return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString(body))}, nil
+			},
+		},
+	}
+
+	response, err := fetchStockData(context.Background(), provider, stockQuery{Symbol: "AAPL", Days: 2, Order: OrderDescending})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(response.Data) != 2 || response.Data[0].Date != "2025-01-15" || response.Data[1].Date != "2025-01-13" {
+		t.Errorf("Expected the two good days, got %+v", response.Data)
+	}
+	expected := []string{`2025-13-45 dropped: invalid date "2025-13-45"`}
+	if !reflect.DeepEqual(response.Warnings, expected) {
+		t.Errorf("Expected warnings %q, got %q", expected, response.Warnings)
+	}
+}
+
+func TestAlphaVantageErrorPayloads(t *testing.T) {
+	tests := []struct {
+		name        string
+		statusCode  int
+		body        string
+		expectedErr error
+	}{
+		{
+			name:        "Per-minute throttle note",
+			statusCode:  http.StatusOK,
+			body:        `{"Note": "Thank you for using Alpha Vantage! Our standard API call frequency is 5 calls per minute and 500 calls per day."}`,
+			expectedErr: ErrRateLimited,
+		},
+		{
+			name:        "Daily rate limit information",
+			statusCode:  http.StatusOK,
+			body:        `{"Information": "Thank you for using Alpha Vantage! Our standard API rate limit is 25 requests per day."}`,
+			expectedErr: ErrRateLimited,
+		},
+		{
+			name:        "Invalid symbol",
+			statusCode:  http.StatusOK,
+			body:        `{"Error Message": "Invalid API call. Please retry or visit the documentation (https://www.alphavantage.co/documentation/) for TIME_SERIES_DAILY."}`,
+			expectedErr: ErrInvalidSymbol,
+		},
+		{
+			name:        "Invalid API key",
+			statusCode:  http.StatusOK,
+			body:        `{"Error Message": "the parameter apikey is invalid or missing. Please claim your free API key on (https://www.alphavantage.co/support/#api-key)."}`,
+			expectedErr: ErrInvalidAPIKey,
+		},
+		{
+			name:        "Other information message",
+			statusCode:  http.StatusOK,
+			body:        `{"Information": "This is a premium endpoint."}`,
+			expectedErr: ErrUpstream,
+		},
+		{
+			name:        "Server error",
+			statusCode:  http.StatusServiceUnavailable,
+			body:        `upstream connect error`,
+			expectedErr: ErrUpstream,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &AlphaVantageProvider{
+				APIKey: "test-api-key",
+				Client: &MockHTTPClient{
+					DoFunc: func(ctx context.Context, rawURL string) (*http.Response, error) {
+						return &http.Response{
+							StatusCode: tt.statusCode,
+							Body:       io.NopCloser(bytes.NewBufferString(tt.body)),
+						}, nil
+					},
+				},
+			}
+
+			_, err := provider.DailyBars(context.Background(), "AAPL", 5)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Errorf("Expected error wrapping %v, got %v", tt.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestAlphaVantageThrottled(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected bool
+	}{
+		{"Per-minute note", `{"Note": "Our standard API call frequency is 5 calls per minute and 500 calls per day."}`, true},
+		{"Per-minute information", `{"Information": "Please consider spreading out your free API requests more sparingly (1 request per minute)."}`, true},
+		{"Daily quota", `{"Information": "Our standard API rate limit is 25 requests per day."}`, false},
+		{"Time series", `{"Time Series (Daily)": {}}`, false},
+		{"Not JSON", `upstream connect error`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := alphaVantageThrottled([]byte(tt.body)); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	// defaultBatchWorkers is the number of concurrent provider calls per
+	// batch request unless BATCH_WORKERS says otherwise
+	defaultBatchWorkers = 4
+	// maxBatchSymbols is the most symbols a single batch request may ask for
+	maxBatchSymbols = 25
+)
+
+// QuotesResponse is the API response format for the batch quotes endpoint
+type QuotesResponse struct {
+	Days   int                       `json:"days"`
+	Quotes map[string]*StockResponse `json:"quotes"`
+	Errors map[string]ErrorDetail    `json:"errors,omitempty"`
+}
+
+// parseSymbols validates a comma separated symbol list, dropping duplicates
+func parseSymbols(s string) ([]string, error) {
+	var symbols []string
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(s, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		symbol, err := parseSymbol(part)
+		if err != nil {
+			return nil, err
+		}
+		if seen[symbol] {
+			continue
+		}
+		seen[symbol] = true
+		symbols = append(symbols, symbol)
+	}
+
+	if len(symbols) == 0 {
+		return nil, fmt.Errorf("at least one symbol is required")
+	}
+	if len(symbols) > maxBatchSymbols {
+		return nil, fmt.Errorf("at most %d symbols are allowed, got %d", maxBatchSymbols, len(symbols))
+	}
+	return symbols, nil
+}
+
+// fetchQuotes fetches stock data as query describes for each symbol using a
+// bounded pool of workers. A failure for one symbol is reported in Errors and
+// does not affect the others.
+func fetchQuotes(ctx context.Context, provider Provider, symbols []string, query stockQuery, workers int) *QuotesResponse {
+	result := &QuotesResponse{
+		Days:   query.Days,
+		Quotes: make(map[string]*StockResponse, len(symbols)),
+		Errors: make(map[string]ErrorDetail),
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(symbols) {
+		workers = len(symbols)
+	}
+
+	jobs := make(chan string)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for symbol := range jobs {
+				query := query
+				query.Symbol = symbol
+				response, err := fetchStockData(ctx, provider, query)
+
+				mu.Lock()
+				if err != nil {
+					slog.WarnContext(ctx, "Quote fetch failed", "symbol", symbol, "error", err)
+					_, result.Errors[symbol] = upstreamError(err)
+				} else {
+					result.Quotes[symbol] = response
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, symbol := range symbols {
+		jobs <- symbol
+	}
+	close(jobs)
+	wg.Wait()
+
+	return result
+}
+
+// batchOutcome summarises the upstream outcome of a batch for the access log
+func batchOutcome(symbols, failed int) string {
+	switch {
+	case failed == 0:
+		return upstreamOutcome(nil)
+	case failed < symbols:
+		return "partial"
+	default:
+		return "failed"
+	}
+}
+
+// createQuotesHandler creates the HTTP handler for the batch quotes endpoint
+func createQuotesHandler(config *Config, provider Provider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, r, http.MethodGet)
+			return
+		}
+
+		values := r.URL.Query()
+		if values.Has("symbol") {
+			writeBadRequest(w, r, &QueryError{Param: "symbol", Message: "not supported by the quotes endpoint, use symbols"})
+			return
+		}
+
+		symbols, err := parseSymbols(values.Get("symbols"))
+		if err != nil {
+			writeBadRequest(w, r, &QueryError{Param: "symbols", Message: err.Error()})
+			return
+		}
+
+		query, err := parseStockQuery(values, config)
+		if err != nil {
+			writeBadRequest(w, r, err)
+			return
+		}
+
+		setRequestQuery(r.Context(), strings.Join(symbols, ","), query.Days)
+
+		ctx, cancel := requestContext(r, config.RequestTimeout)
+		defer cancel()
+
+		response := fetchQuotes(ctx, provider, symbols, query, config.BatchWorkers)
+		setRequestOutcome(r.Context(), batchOutcome(len(symbols), len(response.Errors)), "")
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding response", "error", err)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseSymbols(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		expected    []string
+		expectError bool
+	}{
+		{name: "Single symbol", input: "MSFT", expected: []string{"MSFT"}},
+		{name: "Multiple symbols", input: "msft, aapl,GOOG", expected: []string{"MSFT", "AAPL", "GOOG"}},
+		{name: "Duplicates removed", input: "MSFT,msft,AAPL", expected: []string{"MSFT", "AAPL"}},
+		{name: "Empty entries ignored", input: "MSFT,,AAPL,", expected: []string{"MSFT", "AAPL"}},
+		{name: "Empty list", input: "", expectError: true},
+		{name: "Invalid symbol", input: "MSFT,A$PL", expectError: true},
+		{name: "Too many symbols", input: "A,B,C,D,E,F,G,H,I,J,K,L,M,N,O,P,Q,R,S,T,U,V,W,X,Y,Z", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			symbols, err := parseSymbols(tt.input)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error, got %v", symbols)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(symbols, tt.expected) {
+				t.Errorf("Expected symbols %v, got %v", tt.expected, symbols)
+			}
+		})
+	}
+}
+
+func TestFetchQuotesPartialFailure(t *testing.T) {
+	provider := &MockProvider{
+		DailyBarsFunc: func(ctx context.Context, symbol string, nDays int) ([]TimeSeriesData, error) {
+			if symbol == "BAD" {
+				return nil, fmt.Errorf("no time series data returned")
+			}
+			return []TimeSeriesData{{Date: "2025-01-15", ClosePrice: testPrice("100")}}, nil
+		},
+	}
+
+	result := fetchQuotes(context.Background(), provider, []string{"MSFT", "BAD", "AAPL"}, stockQuery{Days: 5, Order: OrderDescending}, 2)
+
+	if len(result.Quotes) != 2 || result.Quotes["MSFT"] == nil || result.Quotes["AAPL"] == nil {
+		t.Errorf("Expected quotes for MSFT and AAPL, got %v", result.Quotes)
+	}
+	if result.Quotes["MSFT"] != nil && result.Quotes["MSFT"].Symbol != "MSFT" {
+		t.Errorf("Expected MSFT quote to carry its symbol, got %s", result.Quotes["MSFT"].Symbol)
+	}
+	if len(result.Errors) != 1 || result.Errors["BAD"].Code == "" {
+		t.Errorf("Expected a single error for BAD, got %v", result.Errors)
+	}
+}
+
+func TestFetchQuotesBoundsConcurrency(t *testing.T) {
+	var inFlight, maxInFlight int32
+	var mu sync.Mutex
+	provider := &MockProvider{
+		DailyBarsFunc: func(ctx context.Context, symbol string, nDays int) ([]TimeSeriesData, error) {
+			current := atomic.AddInt32(&inFlight, 1)
+			mu.Lock()
+			if current > maxInFlight {
+				maxInFlight = current
+			}
+			mu.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&inFlight, -1)
+			return []TimeSeriesData{{Date: "2025-01-15", ClosePrice: testPrice("100")}}, nil
+		},
+	}
+
+	symbols := []string{"A", "B", "C", "D", "E", "F", "G", "H"}
+	result := fetchQuotes(context.Background(), provider, symbols, stockQuery{Days: 1, Order: OrderDescending}, 3)
+
+	if len(result.Quotes) != len(symbols) {
+		t.Errorf("Expected %d quotes, got %d", len(symbols), len(result.Quotes))
+	}
+	if maxInFlight > 3 {
+		t.Errorf("Expected at most 3 concurrent provider calls, got %d", maxInFlight)
+	}
+}
+
+func TestCreateQuotesHandler(t *testing.T) {
+	config := &Config{
+		Symbol:       "AAPL",
+		NDays:        5,
+		Order:        OrderDescending,
+		MaxDays:      100,
+		BatchWorkers: 2,
+	}
+	provider := &MockProvider{
+		DailyBarsFunc: func(ctx context.Context, symbol string, nDays int) ([]TimeSeriesData, error) {
+			if symbol == "GOOG" {
+				return nil, fmt.Errorf("upstream unavailable")
+			}
+			return []TimeSeriesData{{Date: "2025-01-15", ClosePrice: testPrice("100")}}, nil
+		},
+	}
+	handler := createQuotesHandler(config, provider)
+
+	tests := []struct {
+		name           string
+		method         string
+		target         string
+		expectedStatus int
+	}{
+		{name: "Batch with partial failure", method: http.MethodGet, target: "/v1/quotes?symbols=MSFT,AAPL,GOOG&days=3", expectedStatus: http.StatusOK},
+		{name: "Missing symbols", method: http.MethodGet, target: "/v1/quotes", expectedStatus: http.StatusBadRequest},
+		{name: "Invalid days", method: http.MethodGet, target: "/v1/quotes?symbols=MSFT&days=0", expectedStatus: http.StatusBadRequest},
+		{name: "Single symbol not supported", method: http.MethodGet, target: "/v1/quotes?symbols=MSFT&symbol=AAPL", expectedStatus: http.StatusBadRequest},
+		{name: "POST not allowed", method: http.MethodPost, target: "/v1/quotes?symbols=MSFT", expectedStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(tt.method, tt.target, nil))
+
+			if recorder.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.expectedStatus, recorder.Code, recorder.Body.String())
+			}
+			if tt.expectedStatus == http.StatusBadRequest && !strings.Contains(recorder.Body.String(), `"code":"`+errorCodeInvalidParameter+`"`) {
+				t.Errorf("Expected code %s, got %s", errorCodeInvalidParameter, recorder.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response QuotesResponse
+			if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Days != 3 {
+				t.Errorf("Expected days 3, got %d", response.Days)
+			}
+			if len(response.Quotes) != 2 || response.Quotes["MSFT"] == nil || response.Quotes["AAPL"] == nil {
+				t.Errorf("Expected quotes for MSFT and AAPL, got %v", response.Quotes)
+			}
+			if response.Errors["GOOG"].Code == "" {
+				t.Errorf("Expected an error for GOOG, got %v", response.Errors)
+			}
+		})
+	}
+}
+
+func TestBatchOutcome(t *testing.T) {
+	tests := []struct {
+		symbols, failed int
+		expected        string
+	}{
+		{3, 0, "ok"},
+		{3, 1, "partial"},
+		{3, 3, "failed"},
+	}
+	for _, tt := range tests {
+		if got := batchOutcome(tt.symbols, tt.failed); got != tt.expected {
+			t.Errorf("batchOutcome(%d, %d) = %q, expected %q", tt.symbols, tt.failed, got, tt.expected)
+		}
+	}
+}
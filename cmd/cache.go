@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// CacheStatus describes how the cache served a response
+type CacheStatus string
+
+const (
+	// CacheHit means the bars were served from a fresh cache entry
+	CacheHit CacheStatus = "HIT"
+	// CacheMiss means the bars were fetched from the upstream provider
+	CacheMiss CacheStatus = "MISS"
+	// CacheStale means an expired entry was served while it is refreshed,
+	// either within the stale window or because the upstream call failed
+	CacheStale CacheStatus = "STALE"
+)
+
+// CacheInfo describes how the cache served a set of bars
+type CacheInfo struct {
+	Status CacheStatus
+	Age    time.Duration
+}
+
+const (
+	// cacheStatusHeader is the response header reporting the CacheStatus
+	cacheStatusHeader = "X-Cache-Status"
+	// defaultCacheTTL is how long cached bars are fresh unless CACHE_TTL says otherwise
+	defaultCacheTTL = 5 * time.Minute
+	// defaultCacheStaleTTL is how long past the TTL an entry may still be
+	// served while it is refreshed, unless CACHE_STALE_TTL says otherwise
+	defaultCacheStaleTTL = time.Minute
+	// defaultCacheMaxStale is how old an entry may be and still be served
+	// when the upstream fails, unless CACHE_MAX_STALE says otherwise
+	defaultCacheMaxStale = 24 * time.Hour
+	// cacheFunctionDaily identifies daily time series in cache keys
+	cacheFunctionDaily = "TIME_SERIES_DAILY"
+)
+
+// cacheInfoProvider is implemented by providers that can report how the
+// cache served the bars
+type cacheInfoProvider interface {
+	Provider
+	CachedDailyBars(ctx context.Context, symbol string, nDays int) ([]TimeSeriesData, CacheInfo, error)
+}
+
+// cacheEntry holds the last good bars fetched for one cache key
+type cacheEntry struct {
+	bars      []TimeSeriesData
+	nDays     int
+	fetchedAt time.Time
+	// failing is set when the last refresh of this entry failed, at
+	// failedAt. No background refresh is started for a failing entry until
+	// a TTL has passed since, so that an outage does not spend the upstream
+	// quota on a refresh per request.
+	failing  bool
+	failedAt time.Time
+}
+
+// cacheCall is an in-flight upstream fetch shared by concurrent callers
+type cacheCall struct {
+	done  chan struct{}
+	nDays int
+	bars  []TimeSeriesData
+	err   error
+
+	// cancel abandons the fetch once every waiter has given up, unless it
+	// is a background refresh
+	cancel     context.CancelFunc
+	waiters    int
+	background bool
+}
+
+// CachingProvider is a Provider that caches the bars returned by another
+// Provider. Concurrent misses for the same key share a single upstream call.
+type CachingProvider struct {
+	Provider Provider
+	TTL      time.Duration
+	StaleTTL time.Duration
+	MaxStale time.Duration
+	// Metrics, when set, counts lookups by CacheStatus
+	Metrics *Metrics
+
+	now     func() time.Time
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+	calls   map[string]*cacheCall
+}
+
+// NewCachingProvider wraps provider with a cache of the given TTLs
+func NewCachingProvider(provider Provider, ttl, staleTTL, maxStale time.Duration) *CachingProvider {
+	return &CachingProvider{
+		Provider: provider,
+		TTL:      ttl,
+		StaleTTL: staleTTL,
+		MaxStale: maxStale,
+		now:      time.Now,
+		entries:  make(map[string]*cacheEntry),
+		calls:    make(map[string]*cacheCall),
+	}
+}
+
+// Name implements the Provider interface
+func (c *CachingProvider) Name() string {
+	return c.Provider.Name()
+}
+
+// DailyBars implements the Provider interface
+func (c *CachingProvider) DailyBars(ctx context.Context, symbol string, nDays int) ([]TimeSeriesData, error) {
+	bars, _, err := c.CachedDailyBars(ctx, symbol, nDays)
+	return bars, err
+}
+
+// CachedDailyBars returns the bars for symbol along with how the cache
+// served them. Fresh entries are a HIT. Entries past the TTL but within the
+// stale window are served as STALE while a background refresh runs.
+// Anything else is fetched upstream as a MISS.
+//
+// When the upstream fetch fails, the last good entry up to MaxStale old is
+// served as STALE instead of the error. Until a refresh succeeds, later
+// requests get that entry straight away while a single background refresh
+// retries the upstream, at most once per TTL.
+//
+// A caller whose ctx is done stops waiting for the upstream, falling back to
+// a stale entry like any other failure. The shared fetch is cancelled once
+// no caller is waiting for it. Fetches keep the deadline of the ctx that
+// started them.
+func (c *CachingProvider) CachedDailyBars(ctx context.Context, symbol string, nDays int) ([]TimeSeriesData, CacheInfo, error) {
+	bars, info, err := c.lookup(ctx, symbol, nDays)
+	c.Metrics.ObserveCache(info.Status)
+	return bars, info, err
+}
+
+// lookup implements CachedDailyBars
+func (c *CachingProvider) lookup(ctx context.Context, symbol string, nDays int) ([]TimeSeriesData, CacheInfo, error) {
+	key := cacheKey(symbol, cacheFunctionDaily)
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if ok {
+		age := c.now().Sub(entry.fetchedAt)
+		covers := entry.nDays >= nDays
+		if covers && age < c.TTL {
+			c.mu.Unlock()
+			return entry.bars, CacheInfo{Status: CacheHit, Age: age}, nil
+		}
+		if (entry.failing && age < c.MaxStale) || (covers && age < c.TTL+c.StaleTTL) {
+			if !entry.failing || c.now().Sub(entry.failedAt) >= c.TTL {
+				call := c.startFetchLocked(ctx, key, symbol, max(entry.nDays, nDays))
+				call.background = true
+			}
+			c.mu.Unlock()
+			return entry.bars, CacheInfo{Status: CacheStale, Age: age}, nil
+		}
+	}
+	call := c.startFetchLocked(ctx, key, symbol, nDays)
+	call.waiters++
+	c.mu.Unlock()
+
+	var err error
+	select {
+	case <-call.done:
+		if call.err == nil {
+			return call.bars, CacheInfo{Status: CacheMiss}, nil
+		}
+		err = call.err
+	case <-ctx.Done():
+		c.mu.Lock()
+		call.waiters--
+		if call.waiters == 0 && !call.background {
+			call.cancel()
+			if c.calls[key] == call {
+				delete(c.calls, key)
+			}
+		}
+		c.mu.Unlock()
+		err = ctx.Err()
+	}
+
+	if ok {
+		age := c.now().Sub(entry.fetchedAt)
+		if age < c.MaxStale {
+			slog.WarnContext(ctx, "Serving stale data after upstream error", "key", key, "age", age.String(), "error", err)
+			return entry.bars, CacheInfo{Status: CacheStale, Age: age}, nil
+		}
+	}
+	return nil, CacheInfo{Status: CacheMiss}, err
+}
+
+// startFetchLocked returns the in-flight fetch for key, starting one if none
+// covers nDays. The fetch outlives ctx's cancellation but not its deadline.
+// c.mu must be held.
+func (c *CachingProvider) startFetchLocked(ctx context.Context, key, symbol string, nDays int) *cacheCall {
+	if call, ok := c.calls[key]; ok && call.nDays >= nDays {
+		return call
+	}
+
+	fetchCtx := context.WithoutCancel(ctx)
+	var cancel context.CancelFunc
+	if deadline, ok := ctx.Deadline(); ok {
+		fetchCtx, cancel = context.WithDeadline(fetchCtx, deadline)
+	} else {
+		fetchCtx, cancel = context.WithCancel(fetchCtx)
+	}
+
+	call := &cacheCall{done: make(chan struct{}), nDays: nDays, cancel: cancel}
+	c.calls[key] = call
+
+	go func() {
+		defer cancel()
+		bars, err := c.Provider.DailyBars(fetchCtx, symbol, nDays)
+
+		c.mu.Lock()
+		entry, ok := c.entries[key]
+		if err == nil {
+			if !ok || entry.nDays <= nDays || c.now().Sub(entry.fetchedAt) >= c.TTL {
+				c.entries[key] = &cacheEntry{bars: bars, nDays: nDays, fetchedAt: c.now()}
+			}
+		} else if !errors.Is(err, context.Canceled) {
+			slog.WarnContext(fetchCtx, "Cache fetch failed", "key", key, "error", err)
+			if ok {
+				entry.failing, entry.failedAt = true, c.now()
+			}
+		}
+		if c.calls[key] == call {
+			delete(c.calls, key)
+		}
+		c.mu.Unlock()
+
+		call.bars, call.err = bars, err
+		close(call.done)
+	}()
+
+	return call
+}
+
+// Warm reports whether the cache holds any entry it could still serve when
+// the upstream fails
+func (c *CachingProvider) Warm() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for _, entry := range c.entries {
+		if now.Sub(entry.fetchedAt) < c.MaxStale {
+			return true
+		}
+	}
+	return false
+}
+
+// setCacheHeaders reports how the cache served a response
+func setCacheHeaders(w http.ResponseWriter, cache CacheInfo) {
+	if cache.Status == "" {
+		return
+	}
+	w.Header().Set(cacheStatusHeader, string(cache.Status))
+	if cache.Status != CacheMiss {
+		w.Header().Set("Age", strconv.FormatInt(int64(cache.Age/time.Second), 10))
+	}
+}
+
+// cacheKey identifies the cached series for a symbol and vendor function
+func cacheKey(symbol, function string) string {
+	return symbol + "/" + function
+}
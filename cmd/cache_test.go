@@ -0,0 +1,406 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeClock is a controllable time source for cache tests
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// countingProvider returns a MockProvider that counts its calls
+func countingProvider(calls *int32, delay time.Duration) *MockProvider {
+	return &MockProvider{
+		DailyBarsFunc: func(ctx context.Context, symbol string, nDays int) ([]TimeSeriesData, error) {
+			n := atomic.AddInt32(calls, 1)
+			time.Sleep(delay)
+			return []TimeSeriesData{{Date: "2025-01-15", ClosePrice: Price(n)}}, nil
+		},
+	}
+}
+
+func newTestCache(provider Provider, clock *fakeClock) *CachingProvider {
+	cache := NewCachingProvider(provider, time.Minute, 30*time.Second, time.Hour)
+	cache.now = clock.Now
+	return cache
+}
+
+func TestCachingProviderHitAndMiss(t *testing.T) {
+	var calls int32
+	clock := &fakeClock{now: time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)}
+	cache := newTestCache(countingProvider(&calls, 0), clock)
+
+	_, info, err := cache.CachedDailyBars(context.Background(), "AAPL", 5)
+	if err != nil || info.Status != CacheMiss {
+		t.Fatalf("Expected MISS, got %s (err %v)", info.Status, err)
+	}
+
+	_, info, err = cache.CachedDailyBars(context.Background(), "AAPL", 5)
+	if err != nil || info.Status != CacheHit {
+		t.Fatalf("Expected HIT, got %s (err %v)", info.Status, err)
+	}
+
+	_, info, _ = cache.CachedDailyBars(context.Background(), "MSFT", 5)
+	if info.Status != CacheMiss {
+		t.Errorf("Expected MISS for a different symbol, got %s", info.Status)
+	}
+
+	_, info, _ = cache.CachedDailyBars(context.Background(), "AAPL", 50)
+	if info.Status != CacheMiss {
+		t.Errorf("Expected MISS when more days are needed than cached, got %s", info.Status)
+	}
+
+	if atomic.LoadInt32(&calls) != 3 {
+		t.Errorf("Expected 3 upstream calls, got %d", atomic.LoadInt32(&calls))
+	}
+}
+
+func TestCachingProviderStaleWhileRevalidate(t *testing.T) {
+	var calls int32
+	clock := &fakeClock{now: time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)}
+	cache := newTestCache(countingProvider(&calls, 0), clock)
+
+	if _, _, err := cache.CachedDailyBars(context.Background(), "AAPL", 5); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Past the TTL but within the stale window
+	clock.Advance(75 * time.Second)
+	bars, info, err := cache.CachedDailyBars(context.Background(), "AAPL", 5)
+	if err != nil || info.Status != CacheStale {
+		t.Fatalf("Expected STALE, got %s (err %v)", info.Status, err)
+	}
+	if bars[0].ClosePrice != 1 {
+		t.Errorf("Expected the stale bars to be served, got close %v", bars[0].ClosePrice)
+	}
+
+	// Wait for the background refresh to land
+	deadline := time.Now().Add(time.Second)
+	for {
+		bars, info, _ = cache.CachedDailyBars(context.Background(), "AAPL", 5)
+		if info.Status == CacheHit || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if info.Status != CacheHit || bars[0].ClosePrice != 2 {
+		t.Errorf("Expected refreshed HIT, got %s with close %v", info.Status, bars[0].ClosePrice)
+	}
+
+	// Past the stale window the entry is fetched again synchronously
+	clock.Advance(2 * time.Minute)
+	_, info, _ = cache.CachedDailyBars(context.Background(), "AAPL", 5)
+	if info.Status != CacheMiss {
+		t.Errorf("Expected MISS past the stale window, got %s", info.Status)
+	}
+}
+
+func TestCachingProviderSingleFlight(t *testing.T) {
+	var calls int32
+	clock := &fakeClock{now: time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)}
+	cache := newTestCache(countingProvider(&calls, 20*time.Millisecond), clock)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cache.DailyBars(context.Background(), "AAPL", 5); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("Expected concurrent misses to share 1 upstream call, got %d", atomic.LoadInt32(&calls))
+	}
+}
+
+func TestCachingProviderDoesNotCacheErrors(t *testing.T) {
+	var calls int32
+	provider := &MockProvider{
+		DailyBarsFunc: func(ctx context.Context, symbol string, nDays int) ([]TimeSeriesData, error) {
+			atomic.AddInt32(&calls, 1)
+			return nil, fmt.Errorf("upstream unavailable")
+		},
+	}
+	clock := &fakeClock{now: time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)}
+	cache := newTestCache(provider, clock)
+
+	for i := 0; i < 2; i++ {
+		if _, err := cache.DailyBars(context.Background(), "AAPL", 5); err == nil {
+			t.Fatal("Expected error, got nil")
+		}
+	}
+	if atomic.LoadInt32(&calls) != 2 {
+		t.Errorf("Expected every call to reach upstream, got %d", atomic.LoadInt32(&calls))
+	}
+}
+
+func TestCreateHandlerCacheStatusHeader(t *testing.T) {
+	config := &Config{Symbol: "AAPL", NDays: 5, Order: OrderDescending, MaxDays: 100}
+
+	var calls int32
+	clock := &fakeClock{now: time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)}
+	handler := createHandler(config, newTestCache(countingProvider(&calls, 0), clock))
+
+	for _, expected := range []CacheStatus{CacheMiss, CacheHit} {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, recorder.Code)
+		}
+		if got := recorder.Header().Get(cacheStatusHeader); got != string(expected) {
+			t.Errorf("Expected %s header %s, got %q", cacheStatusHeader, expected, got)
+		}
+	}
+}
+
+// switchableProvider returns a MockProvider that fails while *failing is set
+func switchableProvider(calls *int32, failing *atomic.Bool) *MockProvider {
+	return &MockProvider{
+		DailyBarsFunc: func(ctx context.Context, symbol string, nDays int) ([]TimeSeriesData, error) {
+			n := atomic.AddInt32(calls, 1)
+			if failing.Load() {
+				return nil, fmt.Errorf("Note: API call frequency exceeded")
+			}
+			return []TimeSeriesData{{Date: "2025-01-15", ClosePrice: Price(n)}}, nil
+		},
+	}
+}
+
+func TestCachingProviderServesStaleOnUpstreamError(t *testing.T) {
+	var calls int32
+	var failing atomic.Bool
+	clock := &fakeClock{now: time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)}
+	cache := newTestCache(switchableProvider(&calls, &failing), clock)
+
+	if _, _, err := cache.CachedDailyBars(context.Background(), "AAPL", 5); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Well past the stale window, the upstream starts failing
+	failing.Store(true)
+	clock.Advance(10 * time.Minute)
+
+	bars, info, err := cache.CachedDailyBars(context.Background(), "AAPL", 5)
+	if err != nil {
+		t.Fatalf("Expected stale data instead of error, got %v", err)
+	}
+	if info.Status != CacheStale || info.Age != 10*time.Minute {
+		t.Errorf("Expected STALE aged 10m, got %s aged %s", info.Status, info.Age)
+	}
+	if bars[0].ClosePrice != 1 {
+		t.Errorf("Expected the last good bars, got close %v", bars[0].ClosePrice)
+	}
+
+	// While failing, the stale entry is served without waiting on upstream
+	// and a background refresh picks up the recovery once a TTL has passed
+	failing.Store(false)
+	clock.Advance(time.Minute)
+	deadline := time.Now().Add(time.Second)
+	for {
+		bars, info, err = cache.CachedDailyBars(context.Background(), "AAPL", 5)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if info.Status == CacheHit || time.Now().After(deadline) {
+			break
+		}
+		if info.Status != CacheStale {
+			t.Fatalf("Expected STALE until the refresh lands, got %s", info.Status)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if info.Status != CacheHit || bars[0].ClosePrice == 1 {
+		t.Errorf("Expected refreshed HIT, got %s with close %v", info.Status, bars[0].ClosePrice)
+	}
+}
+
+func TestCachingProviderBacksOffWhileFailing(t *testing.T) {
+	var calls int32
+	var failing atomic.Bool
+	clock := &fakeClock{now: time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)}
+	cache := newTestCache(switchableProvider(&calls, &failing), clock)
+
+	if _, _, err := cache.CachedDailyBars(context.Background(), "AAPL", 5); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The first request during the outage calls the upstream
+	failing.Store(true)
+	clock.Advance(10 * time.Minute)
+	if _, _, err := cache.CachedDailyBars(context.Background(), "AAPL", 5); err != nil {
+		t.Fatalf("Expected stale data instead of error, got %v", err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Fatalf("Expected 2 upstream calls, got %d", n)
+	}
+
+	// Requests within a TTL of the failure are served stale without a refresh
+	for i := 0; i < 50; i++ {
+		_, info, err := cache.CachedDailyBars(context.Background(), "AAPL", 5)
+		if err != nil || info.Status != CacheStale {
+			t.Fatalf("Expected STALE, got %s with error %v", info.Status, err)
+		}
+		clock.Advance(time.Second)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("Expected no refresh within a TTL of the failure, got %d upstream calls", n)
+	}
+
+	// Once a TTL has passed, one background refresh tries again
+	clock.Advance(10 * time.Second)
+	if _, _, err := cache.CachedDailyBars(context.Background(), "AAPL", 5); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&calls) < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&calls); n != 3 {
+		t.Errorf("Expected a refresh once a TTL had passed, got %d upstream calls", n)
+	}
+}
+
+func TestCachingProviderMaxStale(t *testing.T) {
+	var calls int32
+	var failing atomic.Bool
+	clock := &fakeClock{now: time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)}
+	cache := newTestCache(switchableProvider(&calls, &failing), clock)
+
+	if _, _, err := cache.CachedDailyBars(context.Background(), "AAPL", 5); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	failing.Store(true)
+	clock.Advance(2 * time.Hour)
+
+	if _, _, err := cache.CachedDailyBars(context.Background(), "AAPL", 5); err == nil {
+		t.Error("Expected error once the entry is older than MaxStale, got nil")
+	}
+}
+
+func TestCreateHandlerStaleResponse(t *testing.T) {
+	config := &Config{Symbol: "AAPL", NDays: 5, Order: OrderDescending, MaxDays: 100}
+
+	var calls int32
+	var failing atomic.Bool
+	clock := &fakeClock{now: time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)}
+	handler := createHandler(config, newTestCache(switchableProvider(&calls, &failing), clock))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	if strings.Contains(recorder.Body.String(), `"stale"`) {
+		t.Errorf("Expected no stale marker on a fresh response, got %s", recorder.Body.String())
+	}
+
+	failing.Store(true)
+	clock.Advance(5 * time.Minute)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, recorder.Code)
+	}
+	for _, field := range []string{`"stale":true`, `"age_seconds":300`} {
+		if !strings.Contains(recorder.Body.String(), field) {
+			t.Errorf("Expected body to contain %s, got %s", field, recorder.Body.String())
+		}
+	}
+	if got := recorder.Header().Get(cacheStatusHeader); got != string(CacheStale) {
+		t.Errorf("Expected %s header STALE, got %q", cacheStatusHeader, got)
+	}
+	if got := recorder.Header().Get("Age"); got != "300" {
+		t.Errorf("Expected Age header 300, got %q", got)
+	}
+}
+
+func TestCachingProviderCancelledCaller(t *testing.T) {
+	upstreamCancelled := make(chan struct{})
+	provider := &MockProvider{
+		DailyBarsFunc: func(ctx context.Context, symbol string, nDays int) ([]TimeSeriesData, error) {
+			<-ctx.Done()
+			close(upstreamCancelled)
+			return nil, ctx.Err()
+		},
+	}
+	clock := &fakeClock{now: time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)}
+	cache := newTestCache(provider, clock)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	if _, _, err := cache.CachedDailyBars(ctx, "AAPL", 5); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+
+	select {
+	case <-upstreamCancelled:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the shared fetch to be cancelled once no caller was waiting")
+	}
+}
+
+func TestCachingProviderSharedFetchOutlivesOneCaller(t *testing.T) {
+	release := make(chan struct{})
+	provider := &MockProvider{
+		DailyBarsFunc: func(ctx context.Context, symbol string, nDays int) ([]TimeSeriesData, error) {
+			select {
+			case <-release:
+				return []TimeSeriesData{{Date: "2025-01-15", ClosePrice: testPrice("100")}}, nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		},
+	}
+	clock := &fakeClock{now: time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)}
+	cache := newTestCache(provider, clock)
+
+	result := make(chan error, 1)
+	go func() {
+		_, _, err := cache.CachedDailyBars(context.Background(), "AAPL", 5)
+		result <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := cache.CachedDailyBars(ctx, "AAPL", 5); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled for the cancelled caller, got %v", err)
+	}
+
+	close(release)
+	if err := <-result; err != nil {
+		t.Errorf("Expected the remaining caller to get the bars, got %v", err)
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Exit codes returned by run
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// defaultQuoteDays is the number of days the quote command fetches unless
+// --days says otherwise
+const defaultQuoteDays = 5
+
+// Output formats for the quote command
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+)
+
+// usage describes the commands accepted by run
+const usage = `Usage: stock-ticker <command> [flags]
+
+Commands:
+  serve              Run the HTTP server (the default when no command is given)
+  quote SYMBOL       Fetch daily data for SYMBOL and print it
+  validate-config    Check the configuration and report every problem
+
+Run "stock-ticker <command> --help" for the flags of a command.
+`
+
+// providerBuilder builds the provider the quote command fetches from
+type providerBuilder func(config *Config) (Provider, error)
+
+// run runs the command given by args and returns the process exit code
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") && args[0] != "-h" && args[0] != "--help" {
+		return runServe(args, stdout, stderr)
+	}
+
+	switch args[0] {
+	case "serve":
+		return runServe(args[1:], stdout, stderr)
+	case "quote":
+		return runQuote(args[1:], stdout, stderr, func(config *Config) (Provider, error) {
+			provider, _, err := newUpstream(config, nil, nil)
+			return provider, err
+		})
+	case "validate-config":
+		return runValidateConfig(args[1:], stdout, stderr)
+	case "help", "-h", "--help":
+		fmt.Fprint(stdout, usage)
+		return exitOK
+	default:
+		fmt.Fprintf(stderr, "Unknown command %q\n\n%s", args[0], usage)
+		return exitUsage
+	}
+}
+
+// newFlagSet returns a flag set for a command that reports errors to stderr
+func newFlagSet(name, synopsis string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: stock-ticker %s\n\nFlags:\n", synopsis)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseArgs parses flags that may come before or after positional
+// arguments, returning the positional arguments
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// loadCommandConfig loads the configuration for a command and switches
+// logging to the configured level, reporting any errors to stderr
+func loadCommandConfig(path string, overrides map[string]string, stderr io.Writer) (*Config, bool) {
+	config, err := loadConfig(path, overrides)
+	if err != nil {
+		fmt.Fprintf(stderr, "Invalid configuration:\n%v\n", err)
+		return nil, false
+	}
+	slog.SetDefault(newLogger(stderr, config.LogLevel, config.APIKey.Reveal()))
+	return config, true
+}
+
+// newUpstream builds the rate limited, retrying client and the provider
+// described by config. The provider reports its calls to monitor and
+// metrics when they are given.
+func newUpstream(config *Config, monitor *UpstreamMonitor, metrics *Metrics) (Provider, *RateLimiter, error) {
+	limiter := NewRateLimiter(config.RateLimits, config.RateLimitMode, config.RateLimitMaxWait)
+	client := NewRetryingClient(
+		&RateLimitedClient{Client: &DefaultHTTPClient{Timeout: config.UpstreamTimeout}, Limiter: limiter},
+		config.RetryMaxAttempts, config.RetryBaseDelay, config.RetryMaxDelay,
+		providers[config.Provider].Throttled,
+	)
+
+	provider, err := newProvider(config, client, monitor, metrics)
+	if err != nil {
+		return nil, nil, err
+	}
+	return provider, limiter, nil
+}
+
+// runServe runs the HTTP server until SIGTERM or an interrupt
+func runServe(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("serve", "serve [flags]", stderr)
+	configPath := fs.String("config", "", "path to a YAML or JSON config file (default $"+configFileEnv+")")
+	printConfig := fs.Bool("print-config", false, "print the effective configuration, with secrets redacted, and exit")
+	if positional, err := parseArgs(fs, args); err != nil || len(positional) > 0 {
+		return usageError(err, positional, stderr)
+	}
+
+	config, ok := loadCommandConfig(*configPath, nil, stderr)
+	if !ok {
+		return exitError
+	}
+	if *printConfig {
+		if err := writeConfig(stdout, config); err != nil {
+			slog.Error("Error printing configuration", "error", err)
+			return exitError
+		}
+		return exitOK
+	}
+
+	monitor := &UpstreamMonitor{}
+	metrics := NewMetrics()
+	provider, limiter, err := newUpstream(config, monitor, metrics)
+	if err != nil {
+		slog.Error("Error creating provider", "error", err)
+		return exitError
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	if err := startServer(ctx, config, provider, limiter, monitor, metrics); err != nil {
+		slog.Error("Server error", "error", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// runQuote fetches and prints the daily data for one symbol through the
+// same pipeline the HTTP API uses
+func runQuote(args []string, stdout, stderr io.Writer, build providerBuilder) int {
+	fs := newFlagSet("quote", "quote SYMBOL [flags]", stderr)
+	configPath := fs.String("config", "", "path to a YAML or JSON config file (default $"+configFileEnv+")")
+	days := fs.Int("days", defaultQuoteDays, "number of trading days to fetch")
+	order := fs.String("order", "", "sort order, asc or desc (default from the configuration)")
+	format := fs.String("format", formatTable, "output format, table or json")
+	positional, err := parseArgs(fs, args)
+	if err != nil || len(positional) != 1 {
+		return usageError(err, positional, stderr)
+	}
+
+	symbol, err := parseSymbol(positional[0])
+	if err != nil {
+		fmt.Fprintf(stderr, "Invalid symbol: %v\n", err)
+		return exitUsage
+	}
+	if *format != formatTable && *format != formatJSON {
+		fmt.Fprintf(stderr, "Invalid format %q: must be %q or %q\n", *format, formatTable, formatJSON)
+		return exitUsage
+	}
+
+	// --days takes the place of NDAYS and is checked against MAX_DAYS once
+	// the configuration is loaded, so that a bad flag is a usage error
+	overrides := map[string]string{"SYMBOL": symbol, "NDAYS": "1", "ORDER": *order}
+	config, ok := loadCommandConfig(*configPath, overrides, stderr)
+	if !ok {
+		return exitError
+	}
+	config.NDays, err = parseDays(strconv.Itoa(*days), config.MaxDays)
+	if err != nil {
+		fmt.Fprintf(stderr, "Invalid --days: %v\n", err)
+		return exitUsage
+	}
+
+	provider, err := build(config)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error creating provider: %v\n", err)
+		return exitError
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	if config.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.RequestTimeout)
+		defer cancel()
+	}
+
+	response, err := fetchStockData(ctx, provider, defaultStockQuery(config))
+	if err != nil {
+		fmt.Fprintf(stderr, "Error fetching %s: %v\n", config.Symbol, err)
+		return exitError
+	}
+
+	if *format == formatJSON {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(response)
+	} else {
+		err = writeQuoteTable(stdout, response)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "Error writing output: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// writeQuoteTable prints a StockResponse as a fixed width table
+func writeQuoteTable(w io.Writer, response *StockResponse) error {
+	fmt.Fprintf(w, "%s: %d trading days", response.Symbol, response.AvailableDays)
+	if response.AvailableDays < response.Days {
+		fmt.Fprintf(w, " (%d requested)", response.Days)
+	}
+	fmt.Fprintf(w, ", average close %s", response.AverageClose.Text(2))
+	if response.Stale {
+		fmt.Fprintf(w, " (stale, %ds old)", response.AgeSeconds)
+	}
+	fmt.Fprint(w, "\n\n")
+
+	if _, err := fmt.Fprintf(w, "%-10s  %10s  %10s  %10s  %10s  %12s\n", "DATE", "OPEN", "HIGH", "LOW", "CLOSE", "VOLUME"); err != nil {
+		return err
+	}
+	for _, bar := range response.Data {
+		if _, err := fmt.Fprintf(w, "%-10s  %10s  %10s  %10s  %10s  %12d\n", bar.Date, bar.OpenPrice.Text(2), bar.HighPrice.Text(2), bar.LowPrice.Text(2), bar.ClosePrice.Text(2), bar.Volume); err != nil {
+			return err
+		}
+	}
+
+	warnings := append([]string(nil), response.Warnings...)
+	for _, bar := range response.Data {
+		for _, warning := range bar.Warnings {
+			warnings = append(warnings, bar.Date+": "+warning)
+		}
+	}
+	if len(warnings) > 0 {
+		fmt.Fprint(w, "\nWarnings:\n")
+		for _, warning := range warnings {
+			if _, err := fmt.Fprintf(w, "  %s\n", warning); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// runValidateConfig loads the configuration and reports whether it is valid
+func runValidateConfig(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("validate-config", "validate-config [flags]", stderr)
+	configPath := fs.String("config", "", "path to a YAML or JSON config file (default $"+configFileEnv+")")
+	if positional, err := parseArgs(fs, args); err != nil || len(positional) > 0 {
+		return usageError(err, positional, stderr)
+	}
+
+	if _, ok := loadCommandConfig(*configPath, nil, stderr); !ok {
+		return exitError
+	}
+	fmt.Fprintln(stdout, "Configuration is valid")
+	return exitOK
+}
+
+// usageError reports a flag parsing error or unexpected arguments
+func usageError(err error, positional []string, stderr io.Writer) int {
+	switch {
+	case errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case err != nil:
+		// The flag package has already printed the error and usage
+	case len(positional) == 0:
+		fmt.Fprintln(stderr, "Missing argument")
+	default:
+		fmt.Fprintf(stderr, "Unexpected arguments: %s\n", strings.Join(positional, " "))
+	}
+	return exitUsage
+}
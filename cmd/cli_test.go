@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// quoteProvider returns a builder for a provider serving three days of bars
+func quoteProvider(err error) providerBuilder {
+	return func(config *Config) (Provider, error) {
+		return &MockProvider{
+			DailyBarsFunc: func(ctx context.Context, symbol string, nDays int) ([]TimeSeriesData, error) {
+				if err != nil {
+					return nil, err
+				}
+				return []TimeSeriesData{
+					{Date: "2025-01-13", OpenPrice: testPrice("99"), HighPrice: testPrice("101"), LowPrice: testPrice("98.5"), ClosePrice: testPrice("100"), Volume: 1000},
+					{Date: "2025-01-14", OpenPrice: testPrice("100"), HighPrice: testPrice("102"), LowPrice: testPrice("99.5"), ClosePrice: testPrice("101"), Volume: 2000},
+					{Date: "2025-01-15", OpenPrice: testPrice("101"), HighPrice: testPrice("103"), LowPrice: testPrice("100.5"), ClosePrice: testPrice("102"), Volume: 3000},
+				}, nil
+			},
+		}, nil
+	}
+}
+
+func TestRunQuote(t *testing.T) {
+	captureLogs(t)
+	setConfigEnv(t, map[string]string{"APIKEY": "test-api-key"})
+
+	t.Run("Table", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		code := runQuote([]string{"msft", "--days", "2"}, &stdout, &stderr, quoteProvider(nil))
+		if code != exitOK {
+			t.Fatalf("Expected exit code %d, got %d: %s", exitOK, code, stderr.String())
+		}
+
+		expected := []string{
+			"MSFT: 2 trading days, average close 101.50",
+			"DATE              OPEN        HIGH         LOW       CLOSE        VOLUME",
+			"2025-01-15      101.00      103.00      100.50      102.00          3000",
+			"2025-01-14      100.00      102.00       99.50      101.00          2000",
+		}
+		for _, line := range expected {
+			if !strings.Contains(stdout.String(), line) {
+				t.Errorf("Expected %q in the output, got:\n%s", line, stdout.String())
+			}
+		}
+		if strings.Contains(stdout.String(), "2025-01-13") {
+			t.Errorf("Expected only 2 days, got:\n%s", stdout.String())
+		}
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		code := runQuote([]string{"--format", "json", "--order", "asc", "IBM"}, &stdout, &stderr, quoteProvider(nil))
+		if code != exitOK {
+			t.Fatalf("Expected exit code %d, got %d: %s", exitOK, code, stderr.String())
+		}
+
+		var response StockResponse
+		if err := json.Unmarshal(stdout.Bytes(), &response); err != nil {
+			t.Fatalf("Expected a JSON StockResponse, got %q: %v", stdout.String(), err)
+		}
+		if response.Symbol != "IBM" || response.Days != defaultQuoteDays || response.AvailableDays != 3 || len(response.Data) != 3 {
+			t.Errorf("Unexpected response: %+v", response)
+		}
+		if response.Data[0].Date != "2025-01-13" {
+			t.Errorf("Expected ascending order, got %s first", response.Data[0].Date)
+		}
+	})
+}
+
+func TestWriteQuoteTableWarnings(t *testing.T) {
+	response := &StockResponse{
+		Symbol:        "IBM",
+		Days:          2,
+		AvailableDays: 1,
+		AverageClose:  testPrice("102"),
+		Data: []TimeSeriesData{
+			{Date: "2025-01-15", OpenPrice: testPrice("101"), HighPrice: testPrice("103"), LowPrice: testPrice("100.5"), ClosePrice: testPrice("104"), Volume: 3000,
+				Warnings: []string{"close 104 is outside the day's range 100.5 to 103"}},
+		},
+		Warnings: []string{"2025-01-14 dropped: missing close"},
+	}
+
+	var out bytes.Buffer
+	if err := writeQuoteTable(&out, response); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := "\nWarnings:\n  2025-01-14 dropped: missing close\n  2025-01-15: close 104 is outside the day's range 100.5 to 103\n"
+	if !strings.HasSuffix(out.String(), expected) {
+		t.Errorf("Expected output ending in %q, got:\n%s", expected, out.String())
+	}
+}
+
+func TestRunQuoteErrors(t *testing.T) {
+	captureLogs(t)
+	setConfigEnv(t, map[string]string{"APIKEY": "test-api-key"})
+
+	tests := []struct {
+		name         string
+		args         []string
+		env          map[string]string
+		providerErr  error
+		expectedCode int
+		expected     string
+	}{
+		{"Missing symbol", nil, nil, nil, exitUsage, "Missing argument"},
+		{"Two symbols", []string{"AAPL", "MSFT"}, nil, nil, exitUsage, "Unexpected arguments: AAPL MSFT"},
+		{"Invalid symbol", []string{"AAPL;rm"}, nil, nil, exitUsage, "Invalid symbol"},
+		{"Invalid format", []string{"AAPL", "--format", "xml"}, nil, nil, exitUsage, "Invalid format"},
+		{"Too many days", []string{"AAPL", "--days", "101"}, nil, nil, exitUsage, "Invalid --days: must be between 1 and 100, got 101"},
+		{"Days above MAX_DAYS", []string{"AAPL", "--days", "500"}, map[string]string{"MAX_DAYS": "400"}, nil, exitUsage, "Invalid --days: must be between 1 and 400, got 500"},
+		{"Days below one", []string{"AAPL", "--days", "0"}, nil, nil, exitUsage, "Invalid --days"},
+		{"Unknown flag", []string{"AAPL", "--weeks", "2"}, nil, nil, exitUsage, "flag provided but not defined"},
+		{"Invalid configuration", []string{"AAPL"}, map[string]string{"APIKEY": "", "CACHE_TTL": "soon"}, nil, exitError, "Invalid CACHE_TTL value"},
+		{"Upstream failure", []string{"AAPL"}, nil, fmt.Errorf("%w: Invalid API call", ErrInvalidSymbol), exitError, "Error fetching AAPL: invalid symbol"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			var stdout, stderr bytes.Buffer
+			code := runQuote(tt.args, &stdout, &stderr, quoteProvider(tt.providerErr))
+			if code != tt.expectedCode {
+				t.Errorf("Expected exit code %d, got %d", tt.expectedCode, code)
+			}
+			if !strings.Contains(stderr.String(), tt.expected) {
+				t.Errorf("Expected %q on stderr, got:\n%s", tt.expected, stderr.String())
+			}
+			if stdout.Len() != 0 {
+				t.Errorf("Expected nothing on stdout, got:\n%s", stdout.String())
+			}
+		})
+	}
+}
+
+func TestRunValidateConfig(t *testing.T) {
+	captureLogs(t)
+
+	setConfigEnv(t, map[string]string{"SYMBOL": "AAPL", "NDAYS": "5", "APIKEY": "test-api-key"})
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"validate-config"}, &stdout, &stderr); code != exitOK {
+		t.Errorf("Expected exit code %d, got %d: %s", exitOK, code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "Configuration is valid") {
+		t.Errorf("Expected a confirmation, got %q", stdout.String())
+	}
+
+	setConfigEnv(t, map[string]string{"NDAYS": "five", "LOG_LEVEL": "loud"})
+	stdout.Reset()
+	stderr.Reset()
+	if code := run([]string{"validate-config"}, &stdout, &stderr); code != exitError {
+		t.Errorf("Expected exit code %d, got %d", exitError, code)
+	}
+	for _, message := range []string{"SYMBOL is required", "Invalid NDAYS value", "APIKEY is required", "Invalid LOG_LEVEL value"} {
+		if !strings.Contains(stderr.String(), message) {
+			t.Errorf("Expected %q on stderr, got:\n%s", message, stderr.String())
+		}
+	}
+}
+
+func TestRunCommands(t *testing.T) {
+	captureLogs(t)
+	setConfigEnv(t, map[string]string{"SYMBOL": "AAPL", "NDAYS": "5", "APIKEY": "test-api-key"})
+
+	tests := []struct {
+		name         string
+		args         []string
+		expectedCode int
+		stdout       string
+		stderr       string
+	}{
+		{"Help", []string{"help"}, exitOK, "Commands:", ""},
+		{"Help flag", []string{"--help"}, exitOK, "Commands:", ""},
+		{"Unknown command", []string{"fetch"}, exitUsage, "", `Unknown command "fetch"`},
+		{"Print config without a command", []string{"--print-config"}, exitOK, "symbol: AAPL", ""},
+		{"Print config", []string{"serve", "--print-config"}, exitOK, "symbol: AAPL", ""},
+		{"Serve with arguments", []string{"serve", "extra"}, exitUsage, "", "Unexpected arguments: extra"},
+		{"Command help", []string{"quote", "--help"}, exitOK, "", "Usage: stock-ticker quote SYMBOL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := run(tt.args, &stdout, &stderr); code != tt.expectedCode {
+				t.Errorf("Expected exit code %d, got %d", tt.expectedCode, code)
+			}
+			if !strings.Contains(stdout.String(), tt.stdout) {
+				t.Errorf("Expected %q on stdout, got:\n%s", tt.stdout, stdout.String())
+			}
+			if !strings.Contains(stderr.String(), tt.stderr) {
+				t.Errorf("Expected %q on stderr, got:\n%s", tt.stderr, stderr.String())
+			}
+		})
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	days := fs.Int("days", 0, "")
+	format := fs.String("format", "", "")
+
+	positional, err := parseArgs(fs, []string{"--days", "3", "AAPL", "--format", "json", "MSFT"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(positional, []string{"AAPL", "MSFT"}) || *days != 3 || *format != "json" {
+		t.Errorf("Unexpected result: %v, days=%d, format=%q", positional, *days, *format)
+	}
+}
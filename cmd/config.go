@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configFileEnv names the config file when --config is not given
+const configFileEnv = "CONFIG_FILE"
+
+// configSetting is a setting that can be given as an environment variable
+// or as a key in the config file
+type configSetting struct {
+	Env string
+	// Key is the dotted path of the setting in the config file
+	Key string
+	// value returns the effective setting for --print-config, or nil when
+	// it is not set
+	value func(c *Config) any
+}
+
+// configSettings lists every setting. Keys not listed here are rejected
+// when they appear in the config file.
+var configSettings = []configSetting{
+	{"SYMBOL", "symbol", func(c *Config) any { return c.Symbol }},
+	{"NDAYS", "days", func(c *Config) any { return c.NDays }},
+	{"ORDER", "order", func(c *Config) any { return c.Order }},
+	{"PROVIDER", "provider", func(c *Config) any { return c.Provider }},
+	{"MAX_DAYS", "max_days", func(c *Config) any { return c.MaxDays }},
+	{"BATCH_WORKERS", "batch_workers", func(c *Config) any { return c.BatchWorkers }},
+
+	{"AVERAGE_ROUNDING", "average.rounding", func(c *Config) any { return c.AverageRounding.Mode }},
+	{"AVERAGE_DECIMALS", "average.decimals", func(c *Config) any { return c.AverageRounding.Decimals }},
+
+	{"APIKEY", "auth.api_key", func(c *Config) any { return unlessSet(c.APIKey, c.APIKeyFile) }},
+	{"APIKEY_FILE", "auth.api_key_file", func(c *Config) any { return unlessSet(c.APIKeyFile, "") }},
+	{"SECRET_REFRESH_INTERVAL", "auth.refresh_interval", func(c *Config) any { return c.SecretRefresh }},
+
+	{"CACHE_TTL", "cache.ttl", func(c *Config) any { return c.CacheTTL }},
+	{"CACHE_STALE_TTL", "cache.stale_ttl", func(c *Config) any { return c.CacheStaleTTL }},
+	{"CACHE_MAX_STALE", "cache.max_stale", func(c *Config) any { return c.CacheMaxStale }},
+
+	{"RATE_LIMIT_PER_MINUTE", "rate_limit.per_minute", func(c *Config) any { return c.RateLimits.PerMinute }},
+	{"RATE_LIMIT_PER_DAY", "rate_limit.per_day", func(c *Config) any { return c.RateLimits.PerDay }},
+	{"RATE_LIMIT_MODE", "rate_limit.mode", func(c *Config) any { return c.RateLimitMode }},
+	{"RATE_LIMIT_MAX_WAIT", "rate_limit.max_wait", func(c *Config) any { return c.RateLimitMaxWait }},
+
+	{"RETRY_MAX_ATTEMPTS", "retry.max_attempts", func(c *Config) any { return c.RetryMaxAttempts }},
+	{"RETRY_BASE_DELAY", "retry.base_delay", func(c *Config) any { return c.RetryBaseDelay }},
+	{"RETRY_MAX_DELAY", "retry.max_delay", func(c *Config) any { return c.RetryMaxDelay }},
+
+	{"UPSTREAM_TIMEOUT", "upstream.timeout", func(c *Config) any { return c.UpstreamTimeout }},
+
+	{"LISTEN_ADDR", "server.listen_addr", func(c *Config) any { return c.ListenAddr }},
+	{"REQUEST_TIMEOUT", "server.request_timeout", func(c *Config) any { return c.RequestTimeout }},
+	{"SERVER_READ_TIMEOUT", "server.read_timeout", func(c *Config) any { return c.ReadTimeout }},
+	{"SERVER_WRITE_TIMEOUT", "server.write_timeout", func(c *Config) any { return c.WriteTimeout }},
+	{"SERVER_IDLE_TIMEOUT", "server.idle_timeout", func(c *Config) any { return c.IdleTimeout }},
+	{"SHUTDOWN_DELAY", "server.shutdown_delay", func(c *Config) any { return c.ShutdownDelay }},
+	{"SHUTDOWN_TIMEOUT", "server.shutdown_timeout", func(c *Config) any { return c.ShutdownTimeout }},
+
+	{"LOG_LEVEL", "log.level", func(c *Config) any { return strings.ToLower(c.LogLevel.String()) }},
+}
+
+// unlessSet returns value unless other is set or value is empty
+func unlessSet[T ~string](value T, other string) any {
+	if value == "" || other != "" {
+		return nil
+	}
+	return value
+}
+
+// settingKey returns the config file key for an environment variable name
+func settingKey(name string) string {
+	for _, s := range configSettings {
+		if s.Env == name {
+			return s.Key
+		}
+	}
+	return name
+}
+
+// readFile parses the config file into l.file, recording unknown keys and
+// values that are not scalars. Files ending in .json are parsed as JSON,
+// anything else as YAML.
+func (l *configLoader) readFile() {
+	data, err := os.ReadFile(l.path)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("Error reading config file: %v", err))
+		return
+	}
+
+	var tree map[string]any
+	if strings.EqualFold(filepath.Ext(l.path), ".json") {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		err = decoder.Decode(&tree)
+	} else {
+		err = yaml.Unmarshal(data, &tree)
+	}
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("Error parsing config file %s: %v", l.path, err))
+		return
+	}
+
+	envNames := make(map[string]string, len(configSettings))
+	for _, s := range configSettings {
+		envNames[s.Key] = s.Env
+	}
+	l.flatten("", tree, envNames)
+}
+
+// flatten stores the scalar values of tree under their environment
+// variable names, visiting keys in order so errors are reported stably
+func (l *configLoader) flatten(prefix string, tree map[string]any, envNames map[string]string) {
+	keys := make([]string, 0, len(tree))
+	for key := range tree {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		path := prefix + key
+		value := tree[key]
+		name, known := envNames[path]
+
+		switch value := value.(type) {
+		case map[string]any:
+			if known {
+				l.errs = append(l.errs, fmt.Errorf("Invalid %s value in %s: must be a single value", path, l.path))
+				continue
+			}
+			l.flatten(path+".", value, envNames)
+		case []any:
+			if known {
+				l.errs = append(l.errs, fmt.Errorf("Invalid %s value in %s: must be a single value", path, l.path))
+			} else {
+				l.errs = append(l.errs, fmt.Errorf("Unknown setting %s in %s", path, l.path))
+			}
+		case nil:
+			if !known {
+				l.errs = append(l.errs, fmt.Errorf("Unknown setting %s in %s", path, l.path))
+			}
+		default:
+			if !known {
+				l.errs = append(l.errs, fmt.Errorf("Unknown setting %s in %s", path, l.path))
+				continue
+			}
+			if s := fmt.Sprint(value); s != "" {
+				l.file[name] = s
+			}
+		}
+	}
+}
+
+// writeConfig writes the effective configuration in the config file
+// format. Secrets are redacted.
+func writeConfig(w io.Writer, config *Config) error {
+	tree := make(map[string]any)
+	for _, s := range configSettings {
+		parts := strings.Split(s.Key, ".")
+		node := tree
+		for _, part := range parts[:len(parts)-1] {
+			child, ok := node[part].(map[string]any)
+			if !ok {
+				child = make(map[string]any)
+				node[part] = child
+			}
+			node = child
+		}
+		if value := s.value(config); value != nil {
+			node[parts[len(parts)-1]] = value
+		}
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(tree); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setConfigEnv clears every setting for the rest of the test and then sets
+// envVars
+func setConfigEnv(t *testing.T, envVars map[string]string) {
+	t.Helper()
+	for _, name := range configEnvVars {
+		t.Setenv(name, "")
+	}
+	for name, value := range envVars {
+		t.Setenv(name, value)
+	}
+}
+
+// writeConfigFile writes a config file named name into a temporary directory
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	keyFile := writeConfigFile(t, "apikey", "file-api-key\n")
+
+	yamlConfig := writeConfigFile(t, "config.yaml", `
+symbol: msft
+days: 10
+provider: alphavantage
+auth:
+  api_key_file: `+keyFile+`
+cache:
+  ttl: 2m
+rate_limit:
+  per_minute: 30
+  mode: reject
+server:
+  listen_addr: ":9090"
+  request_timeout: 15s
+log:
+  level: debug
+`)
+	jsonConfig := writeConfigFile(t, "config.json", `{
+  "symbol": "msft",
+  "days": 10,
+  "auth": {"api_key_file": "`+keyFile+`"},
+  "cache": {"ttl": "2m"},
+  "rate_limit": {"per_minute": 30, "mode": "reject"},
+  "server": {"listen_addr": ":9090", "request_timeout": "15s"},
+  "log": {"level": "debug"}
+}`)
+
+	for _, path := range []string{yamlConfig, jsonConfig} {
+		t.Run(filepath.Ext(path), func(t *testing.T) {
+			setConfigEnv(t, map[string]string{
+				"NDAYS":               "3",
+				"SERVER_READ_TIMEOUT": "1s",
+			})
+
+			config, err := loadConfig(path, nil)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			checks := []struct {
+				name          string
+				got, expected any
+			}{
+				{"Symbol", config.Symbol, "MSFT"},
+				{"NDays from the environment", config.NDays, 3},
+				{"APIKey", config.APIKey, Secret("file-api-key")},
+				{"APIKeyFile", config.APIKeyFile, keyFile},
+				{"CacheTTL", config.CacheTTL, 2 * time.Minute},
+				{"RateLimits", config.RateLimits, RateLimits{PerMinute: 30, PerDay: alphaVantageRateLimits.PerDay}},
+				{"RateLimitMode", config.RateLimitMode, RateLimitReject},
+				{"ListenAddr", config.ListenAddr, ":9090"},
+				{"RequestTimeout", config.RequestTimeout, 15 * time.Second},
+				{"ReadTimeout from the environment", config.ReadTimeout, time.Second},
+				{"WriteTimeout default", config.WriteTimeout, defaultWriteTimeout},
+				{"LogLevel", config.LogLevel.String(), "DEBUG"},
+			}
+			for _, check := range checks {
+				if !reflect.DeepEqual(check.got, check.expected) {
+					t.Errorf("%s: expected %v, got %v", check.name, check.expected, check.got)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadConfigFileFromEnvironment(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", "symbol: IBM\ndays: 5\nauth:\n  api_key: inline-key\n")
+	setConfigEnv(t, map[string]string{"CONFIG_FILE": path})
+
+	config, err := loadConfig("", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if config.Symbol != "IBM" || config.APIKey != "inline-key" || config.APIKeyFile != "" {
+		t.Errorf("Expected settings from CONFIG_FILE, got %+v", config)
+	}
+}
+
+func TestLoadConfigReportsAllErrors(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", `
+symbol: AAPL
+days: ten
+order: sideways
+cache:
+  ttl: soon
+  tll: 5m
+server:
+  listen_addr: [":8080"]
+rate_limit: 5
+`)
+	setConfigEnv(t, map[string]string{"MAX_DAYS": "0"})
+
+	_, err := loadConfig(path, nil)
+	if err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+
+	expected := []string{
+		"Invalid days value in " + path,
+		"Invalid order value in " + path,
+		"Invalid cache.ttl value in " + path,
+		"Unknown setting cache.tll in " + path,
+		"Invalid server.listen_addr value in " + path + ": must be a single value",
+		"Unknown setting rate_limit in " + path,
+		"Invalid MAX_DAYS value: must be at least 1",
+		"APIKEY is required",
+	}
+	for _, message := range expected {
+		if !strings.Contains(err.Error(), message) {
+			t.Errorf("Expected the error to report %q, got:\n%v", message, err)
+		}
+	}
+	if lines := strings.Count(err.Error(), "\n") + 1; lines != len(expected) {
+		t.Errorf("Expected %d errors, got %d:\n%v", len(expected), lines, err)
+	}
+}
+
+func TestLoadConfigFileErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		content  string
+		expected string
+	}{
+		{"Missing file", "", "", "Error reading config file"},
+		{"Malformed YAML", "config.yaml", "symbol: [AAPL", "Error parsing config file"},
+		{"Malformed JSON", "config.json", `{"symbol": "AAPL",}`, "Error parsing config file"},
+		{"Inline and file API key", "config.yaml", "symbol: AAPL\ndays: 5\nauth:\n  api_key: a\n  api_key_file: /tmp/b\n", "auth.api_key_file is also set"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setConfigEnv(t, nil)
+			path := filepath.Join(t.TempDir(), "missing.yaml")
+			if tt.file != "" {
+				path = writeConfigFile(t, tt.file, tt.content)
+			}
+
+			_, err := loadConfig(path, nil)
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expected error containing %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestWriteConfig(t *testing.T) {
+	setConfigEnv(t, map[string]string{
+		"SYMBOL":          "AAPL",
+		"NDAYS":           "5",
+		"APIKEY":          "test-api-key",
+		"CACHE_TTL":       "90s",
+		"RATE_LIMIT_MODE": "reject",
+		"LOG_LEVEL":       "warn",
+	})
+	config, err := loadConfig("", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeConfig(&buf, config); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	output := buf.String()
+
+	if strings.Contains(output, "test-api-key") || !strings.Contains(output, "api_key: '"+redactedValue+"'") {
+		t.Errorf("Expected the API key to be redacted, got:\n%s", output)
+	}
+	for _, line := range []string{"ttl: 1m30s", "mode: reject", "level: warn", "symbol: AAPL"} {
+		if !strings.Contains(output, line) {
+			t.Errorf("Expected %q in the printed config, got:\n%s", line, output)
+		}
+	}
+
+	if strings.Contains(output, "api_key_file") {
+		t.Errorf("Expected unset settings to be left out, got:\n%s", output)
+	}
+
+	// The printed config loads back to the same configuration
+	path := writeConfigFile(t, "printed.yaml", output)
+	setConfigEnv(t, map[string]string{"APIKEY": "test-api-key"})
+	reloaded, err := loadConfig(path, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error loading the printed config: %v", err)
+	}
+	if !reflect.DeepEqual(reloaded, config) {
+		t.Errorf("Expected the printed config to load back unchanged:\nexpected %+v\ngot      %+v", config, reloaded)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// tradingDateLayout is the date format used for time series keys
+const tradingDateLayout = "2006-01-02"
+
+// SortOrder controls the order of days in a StockResponse
+type SortOrder string
+
+const (
+	// OrderDescending returns the newest day first
+	OrderDescending SortOrder = "desc"
+	// OrderAscending returns the oldest day first
+	OrderAscending SortOrder = "asc"
+)
+
+// parseSortOrder parses a sort order, defaulting to descending when empty
+func parseSortOrder(s string) (SortOrder, error) {
+	switch SortOrder(strings.ToLower(strings.TrimSpace(s))) {
+	case "", OrderDescending:
+		return OrderDescending, nil
+	case OrderAscending:
+		return OrderAscending, nil
+	default:
+		return "", fmt.Errorf("invalid sort order %q: must be %q or %q", s, OrderAscending, OrderDescending)
+	}
+}
+
+// DateKeyError reports time series keys that are not valid trading dates
+type DateKeyError struct {
+	Keys []string
+}
+
+// Error implements the error interface
+func (e *DateKeyError) Error() string {
+	return fmt.Sprintf("malformed date keys in time series: %s", strings.Join(e.Keys, ", "))
+}
+
+// parseTradingDate parses a time series key as a trading date
+func parseTradingDate(key string) (time.Time, error) {
+	return time.Parse(tradingDateLayout, key)
+}
+
+// sortTradingDates parses the keys as trading dates and sorts them newest-first.
+// Any keys that cannot be parsed are reported together in a *DateKeyError.
+func sortTradingDates(keys []string) ([]string, error) {
+	type tradingDay struct {
+		key  string
+		date time.Time
+	}
+
+	days := make([]tradingDay, 0, len(keys))
+	var malformed []string
+	for _, key := range keys {
+		date, err := parseTradingDate(key)
+		if err != nil {
+			malformed = append(malformed, key)
+			continue
+		}
+		days = append(days, tradingDay{key: key, date: date})
+	}
+
+	if len(malformed) > 0 {
+		sort.Strings(malformed)
+		return nil, &DateKeyError{Keys: malformed}
+	}
+
+	sort.Slice(days, func(i, j int) bool {
+		return days[i].date.After(days[j].date)
+	})
+
+	sorted := make([]string, len(days))
+	for i, day := range days {
+		sorted[i] = day.key
+	}
+	return sorted, nil
+}
+
+// selectTradingDays returns the most recent nDays keys in the requested order
+func selectTradingDays(keys []string, nDays int, order SortOrder) ([]string, error) {
+	sorted, err := sortTradingDates(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	if nDays < 0 {
+		nDays = 0
+	}
+	if len(sorted) > nDays {
+		sorted = sorted[:nDays]
+	}
+
+	if order == OrderAscending {
+		for i, j := 0, len(sorted)-1; i < j; i, j = i+1, j-1 {
+			sorted[i], sorted[j] = sorted[j], sorted[i]
+		}
+	}
+
+	return sorted, nil
+}
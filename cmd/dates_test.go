@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseSortOrder(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		expected    SortOrder
+		expectError bool
+	}{
+		{name: "Empty defaults to descending", input: "", expected: OrderDescending},
+		{name: "Descending", input: "desc", expected: OrderDescending},
+		{name: "Ascending", input: "asc", expected: OrderAscending},
+		{name: "Mixed case", input: " ASC ", expected: OrderAscending},
+		{name: "Invalid", input: "random", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order, err := parseSortOrder(tt.input)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error, got order %q", order)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if order != tt.expected {
+				t.Errorf("Expected order %q, got %q", tt.expected, order)
+			}
+		})
+	}
+}
+
+func TestSelectTradingDays(t *testing.T) {
+	keys := []string{"2025-01-10", "2025-01-15", "2024-12-31", "2025-01-14", "2025-01-13"}
+
+	tests := []struct {
+		name     string
+		nDays    int
+		order    SortOrder
+		expected []string
+	}{
+		{
+			name:     "Most recent days descending",
+			nDays:    3,
+			order:    OrderDescending,
+			expected: []string{"2025-01-15", "2025-01-14", "2025-01-13"},
+		},
+		{
+			name:     "Most recent days ascending",
+			nDays:    3,
+			order:    OrderAscending,
+			expected: []string{"2025-01-13", "2025-01-14", "2025-01-15"},
+		},
+		{
+			name:     "Sorts across year boundary",
+			nDays:    10,
+			order:    OrderDescending,
+			expected: []string{"2025-01-15", "2025-01-14", "2025-01-13", "2025-01-10", "2024-12-31"},
+		},
+		{
+			name:     "Zero days",
+			nDays:    0,
+			order:    OrderDescending,
+			expected: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dates, err := selectTradingDays(keys, tt.nDays, tt.order)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(dates, tt.expected) {
+				t.Errorf("Expected dates %v, got %v", tt.expected, dates)
+			}
+		})
+	}
+}
+
+func TestSelectTradingDaysMalformedKeys(t *testing.T) {
+	keys := []string{"2025-01-15", "15/01/2025", "2025-02-30", "latest"}
+
+	_, err := selectTradingDays(keys, 5, OrderDescending)
+	if err == nil {
+		t.Fatal("Expected error for malformed date keys, got nil")
+	}
+
+	var dateErr *DateKeyError
+	if !errors.As(err, &dateErr) {
+		t.Fatalf("Expected *DateKeyError, got %T", err)
+	}
+
+	expected := []string{"15/01/2025", "2025-02-30", "latest"}
+	if !reflect.DeepEqual(dateErr.Keys, expected) {
+		t.Errorf("Expected malformed keys %v, got %v", expected, dateErr.Keys)
+	}
+}
+
+func TestProcessTimeSeriesIsDeterministic(t *testing.T) {
+	timeSeries := map[string]alphaVantageBar{}
+	for _, date := range []string{
+		"2025-01-02", "2025-01-03", "2025-01-06", "2025-01-07", "2025-01-08",
+		"2025-01-09", "2025-01-10", "2025-01-13", "2025-01-14", "2025-01-15",
+	} {
+		timeSeries[date] = alphaVantageBar{
+			Open:   "100.00",
+			High:   "101.00",
+			Low:    "99.00",
+			Close:  "100.50",
+			Volume: "1000",
+		}
+	}
+
+	expected := []string{"2025-01-15", "2025-01-14", "2025-01-13"}
+
+	// Map iteration order is randomized, so repeat enough times to catch
+	// any dependence on it
+	for i := 0; i < 50; i++ {
+		data, err := processTimeSeries(parseAlphaVantageSeries(timeSeries), 3, OrderDescending)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		dates := make([]string, len(data))
+		for j, day := range data {
+			dates[j] = day.Date
+		}
+		if !reflect.DeepEqual(dates, expected) {
+			t.Fatalf("Iteration %d: expected dates %v, got %v", i, expected, dates)
+		}
+	}
+}
+
+func TestProcessTimeSeriesRejectsMalformedDates(t *testing.T) {
+	bars := []TimeSeriesData{
+		{Date: "2025-01-15", ClosePrice: testPrice("235.60")},
+		{Date: "not-a-date", ClosePrice: testPrice("233.60")},
+	}
+
+	if _, err := processTimeSeries(bars, 2, OrderDescending); err == nil {
+		t.Error("Expected error for malformed date key, got nil")
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fileSuffix marks a variable naming a file that holds a setting, such as
+// APIKEY_FILE for APIKEY. This is how Docker and Kubernetes secrets are
+// usually passed to a container.
+const fileSuffix = "_FILE"
+
+// configLoader resolves settings from command line overrides, then the
+// environment, then the config file. Invalid settings are collected rather
+// than returned so that every problem can be reported at once.
+type configLoader struct {
+	// overrides holds settings given on the command line
+	overrides map[string]string
+	// path is the config file, if any
+	path string
+	// file maps environment variable names to the config file values
+	file map[string]string
+	// fromFile records the settings whose value came from the config file
+	fromFile map[string]bool
+	// valueFiles records the file each setting read through _FILE came from
+	valueFiles map[string]string
+	errs       []error
+}
+
+// newConfigLoader returns a loader for overrides, the environment and the
+// config file at path, all of which are optional
+func newConfigLoader(path string, overrides map[string]string) *configLoader {
+	l := &configLoader{
+		overrides:  overrides,
+		path:       path,
+		file:       make(map[string]string),
+		fromFile:   make(map[string]bool),
+		valueFiles: make(map[string]string),
+	}
+	if path != "" {
+		l.readFile()
+	}
+	return l
+}
+
+// lookup returns the raw value of a setting, or "" when it is unset. The
+// environment takes precedence over the config file.
+func (l *configLoader) lookup(name string) string {
+	if value := l.overrides[name]; value != "" {
+		return value
+	}
+
+	value, path := os.Getenv(name), os.Getenv(name+fileSuffix)
+	switch {
+	case value != "" && path != "":
+		l.errs = append(l.errs, fmt.Errorf("Invalid %s value: %s%s is also set, use only one", name, name, fileSuffix))
+		return ""
+	case value != "":
+		return value
+	case path != "":
+		return l.readValueFile(name, path)
+	}
+
+	value, hasValue := l.file[name]
+	path, hasPath := l.file[name+fileSuffix]
+	if hasValue || hasPath {
+		l.fromFile[name] = true
+	}
+	switch {
+	case hasValue && hasPath:
+		l.invalid(name, fmt.Errorf("%s is also set, use only one", settingKey(name+fileSuffix)))
+		return ""
+	case hasPath:
+		return l.readValueFile(name, path)
+	}
+	return value
+}
+
+// readValueFile reads a setting from the file at path
+func (l *configLoader) readValueFile(name, path string) string {
+	value, err := readSettingFile(path)
+	if err != nil {
+		l.invalid(name+fileSuffix, err)
+		return ""
+	}
+	l.valueFiles[name] = path
+	return value
+}
+
+// readSettingFile reads a setting from a file, trimming surrounding
+// whitespace such as the trailing newline most editors add
+func readSettingFile(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// invalid records an invalid setting, naming it the way it was given
+func (l *configLoader) invalid(name string, err error) {
+	base := strings.TrimSuffix(name, fileSuffix)
+	if l.fromFile[base] {
+		l.errs = append(l.errs, fmt.Errorf("Invalid %s value in %s: %v", settingKey(name), l.path, err))
+		return
+	}
+	l.errs = append(l.errs, fmt.Errorf("Invalid %s value: %v", name, err))
+}
+
+// required reads a setting that must be set
+func (l *configLoader) required(name string) string {
+	errs := len(l.errs)
+	value := l.lookup(name)
+	if value == "" && len(l.errs) == errs {
+		l.errs = append(l.errs, fmt.Errorf("%s is required: set the %s environment variable or %s in the config file", name, name, settingKey(name)))
+	}
+	return value
+}
+
+// int reads an optional integer setting, returning fallback when unset
+func (l *configLoader) int(name string, fallback, min int) int {
+	s := l.lookup(name)
+	if s == "" {
+		return fallback
+	}
+
+	value, err := strconv.Atoi(s)
+	if err != nil {
+		l.invalid(name, err)
+		return fallback
+	}
+	if value < min {
+		l.invalid(name, fmt.Errorf("must be at least %d, got %d", min, value))
+		return fallback
+	}
+	return value
+}
+
+// duration reads an optional duration setting such as "30s" or "5m",
+// returning fallback when unset
+func (l *configLoader) duration(name string, fallback time.Duration) time.Duration {
+	s := l.lookup(name)
+	if s == "" {
+		return fallback
+	}
+
+	value, err := time.ParseDuration(s)
+	if err != nil {
+		l.invalid(name, err)
+		return fallback
+	}
+	if value < 0 {
+		l.invalid(name, fmt.Errorf("must not be negative, got %s", value))
+		return fallback
+	}
+	return value
+}
+
+// parseSetting reads an optional setting with parse, which is given "" when
+// the setting is unset so it can apply its own default
+func parseSetting[T any](l *configLoader, name string, parse func(string) (T, error)) T {
+	value, err := parse(l.lookup(name))
+	if err != nil {
+		l.invalid(name, err)
+	}
+	return value
+}
+
+// parseRequired reads a setting that must be set with parse
+func parseRequired[T any](l *configLoader, name string, parse func(string) (T, error)) T {
+	var value T
+	s := l.required(name)
+	if s == "" {
+		return value
+	}
+	value, err := parse(s)
+	if err != nil {
+		l.invalid(name, err)
+	}
+	return value
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"regexp"
+)
+
+// Error codes returned in ErrorResponse
+const (
+	errorCodeNotFound         = "not_found"
+	errorCodeMethodNotAllowed = "method_not_allowed"
+	errorCodeInvalidParameter = "invalid_parameter"
+	errorCodeRateLimited      = "rate_limited"
+	errorCodeInvalidSymbol    = "invalid_symbol"
+	errorCodeUpstreamAuth     = "upstream_auth_failed"
+	errorCodeUpstreamFailed   = "upstream_error"
+	errorCodeUpstreamTimeout  = "upstream_timeout"
+)
+
+// rateLimitRetryAfter is the Retry-After value sent with 429 responses, in
+// seconds. Alpha Vantage quotas are enforced per minute.
+const rateLimitRetryAfter = "60"
+
+// requestIDHeader carries the request ID on requests and responses
+const requestIDHeader = "X-Request-ID"
+
+// requestIDPattern matches the caller supplied request IDs we accept
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._\-]{1,128}$`)
+
+// ErrorResponse is the API error response format
+type ErrorResponse struct {
+	Error ErrorDetail `json:"error"`
+}
+
+// ErrorDetail describes a single API error. Messages are safe to show to
+// callers; upstream details are logged against the request ID instead.
+type ErrorDetail struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+	Retryable bool   `json:"retryable"`
+}
+
+// requestID returns the ID assigned to the request by instrumentHandler.
+// Otherwise it returns the caller's X-Request-ID when it is well formed, or
+// generates a new one.
+func requestID(r *http.Request) string {
+	if id, ok := r.Context().Value(requestIDKey).(string); ok {
+		return id
+	}
+	if id := r.Header.Get(requestIDHeader); requestIDPattern.MatchString(id) {
+		return id
+	}
+	return newRequestID()
+}
+
+// newRequestID generates a random request ID
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// writeError writes a JSON ErrorResponse with the given status code
+func writeError(w http.ResponseWriter, r *http.Request, status int, detail ErrorDetail) {
+	if detail.RequestID == "" {
+		detail.RequestID = requestID(r)
+	}
+
+	w.Header().Set(requestIDHeader, detail.RequestID)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(ErrorResponse{Error: detail}); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding error response", "error", err)
+	}
+}
+
+// writeNotFound rejects a request for a path the API does not serve
+func writeNotFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusNotFound, ErrorDetail{
+		Code:    errorCodeNotFound,
+		Message: "Not found",
+	})
+}
+
+// writeMethodNotAllowed rejects a request whose method the handler does not serve
+func writeMethodNotAllowed(w http.ResponseWriter, r *http.Request, allowed string) {
+	w.Header().Set("Allow", allowed)
+	writeError(w, r, http.StatusMethodNotAllowed, ErrorDetail{
+		Code:    errorCodeMethodNotAllowed,
+		Message: "Method not allowed",
+	})
+}
+
+// writeBadRequest rejects a request with an invalid parameter. The message
+// only describes the caller's own input so it is returned as is.
+func writeBadRequest(w http.ResponseWriter, r *http.Request, err error) {
+	writeError(w, r, http.StatusBadRequest, ErrorDetail{
+		Code:    errorCodeInvalidParameter,
+		Message: err.Error(),
+	})
+}
+
+// upstreamError maps an error from fetchStockData to an HTTP status and an
+// ErrorDetail that does not expose the upstream error text
+func upstreamError(err error) (int, ErrorDetail) {
+	switch {
+	case errors.Is(err, ErrRateLimited):
+		return http.StatusTooManyRequests, ErrorDetail{
+			Code:      errorCodeRateLimited,
+			Message:   "Upstream rate limit exceeded, try again later",
+			Retryable: true,
+		}
+	case errors.Is(err, ErrInvalidSymbol):
+		return http.StatusNotFound, ErrorDetail{
+			Code:    errorCodeInvalidSymbol,
+			Message: "Symbol not found",
+		}
+	case errors.Is(err, ErrInvalidAPIKey):
+		return http.StatusBadGateway, ErrorDetail{
+			Code:    errorCodeUpstreamAuth,
+			Message: "Upstream provider rejected the service credentials",
+		}
+	case isTimeout(err):
+		return http.StatusGatewayTimeout, ErrorDetail{
+			Code:      errorCodeUpstreamTimeout,
+			Message:   "Timed out fetching stock data",
+			Retryable: true,
+		}
+	default:
+		return http.StatusInternalServerError, ErrorDetail{
+			Code:      errorCodeUpstreamFailed,
+			Message:   "Error fetching stock data",
+			Retryable: true,
+		}
+	}
+}
+
+// isTimeout reports whether err comes from a request or upstream deadline
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// writeUpstreamError logs an error from fetchStockData and writes the
+// matching HTTP response. Nothing is written once the client has gone away.
+func writeUpstreamError(w http.ResponseWriter, r *http.Request, err error) {
+	status, detail := upstreamError(err)
+	detail.RequestID = requestID(r)
+	if r.Context().Err() != nil && errors.Is(err, context.Canceled) {
+		slog.InfoContext(r.Context(), "Client went away", "error", err)
+		return
+	}
+
+	level := slog.LevelWarn
+	if status >= http.StatusInternalServerError {
+		level = slog.LevelError
+	}
+	slog.Log(r.Context(), level, "Upstream error", "status", status, "code", detail.Code, "error", err)
+
+	if status == http.StatusTooManyRequests {
+		w.Header().Set("Retry-After", rateLimitRetryAfter)
+	}
+	writeError(w, r, status, detail)
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateHandlerUpstreamErrors(t *testing.T) {
+	config := &Config{Symbol: "AAPL", NDays: 5, Order: OrderDescending, MaxDays: 100}
+
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+		expectedCode   string
+		retryable      bool
+	}{
+		{
+			name:           "Rate limited",
+			err:            fmt.Errorf("%w: call frequency exceeded", ErrRateLimited),
+			expectedStatus: http.StatusTooManyRequests,
+			expectedCode:   errorCodeRateLimited,
+			retryable:      true,
+		},
+		{
+			name:           "Invalid symbol",
+			err:            fmt.Errorf("%w: Invalid API call", ErrInvalidSymbol),
+			expectedStatus: http.StatusNotFound,
+			expectedCode:   errorCodeInvalidSymbol,
+		},
+		{
+			name:           "Invalid API key",
+			err:            fmt.Errorf("%w: the parameter apikey is invalid", ErrInvalidAPIKey),
+			expectedStatus: http.StatusBadGateway,
+			expectedCode:   errorCodeUpstreamAuth,
+		},
+		{
+			name:           "Upstream timeout",
+			err:            fmt.Errorf("retry aborted after 2 attempts: %w", context.DeadlineExceeded),
+			expectedStatus: http.StatusGatewayTimeout,
+			expectedCode:   errorCodeUpstreamTimeout,
+			retryable:      true,
+		},
+		{
+			name:           "Other error",
+			err:            fmt.Errorf("Get \"https://www.alphavantage.co/query?apikey=secret\": network error"),
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   errorCodeUpstreamFailed,
+			retryable:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &MockProvider{
+				DailyBarsFunc: func(ctx context.Context, symbol string, nDays int) ([]TimeSeriesData, error) {
+					return nil, tt.err
+				},
+			}
+
+			recorder := httptest.NewRecorder()
+			createHandler(config, provider).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if recorder.Code != tt.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", tt.expectedStatus, recorder.Code)
+			}
+			if ct := recorder.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Expected JSON content type, got %q", ct)
+			}
+
+			var response ErrorResponse
+			if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode error response: %v", err)
+			}
+			if response.Error.Code != tt.expectedCode {
+				t.Errorf("Expected error code %q, got %q", tt.expectedCode, response.Error.Code)
+			}
+			if response.Error.Message == "" {
+				t.Error("Expected an error message")
+			}
+			if strings.Contains(response.Error.Message, tt.err.Error()) || strings.Contains(recorder.Body.String(), "apikey") {
+				t.Errorf("Expected upstream details to be hidden, got %q", recorder.Body.String())
+			}
+			if response.Error.RequestID == "" || response.Error.RequestID != recorder.Header().Get(requestIDHeader) {
+				t.Errorf("Expected request ID in body and header, got %q and %q", response.Error.RequestID, recorder.Header().Get(requestIDHeader))
+			}
+			if response.Error.Retryable != tt.retryable {
+				t.Errorf("Expected retryable %v, got %v", tt.retryable, response.Error.Retryable)
+			}
+
+			if tt.expectedStatus == http.StatusTooManyRequests && recorder.Header().Get("Retry-After") == "" {
+				t.Error("Expected a Retry-After header on 429 responses")
+			}
+		})
+	}
+}
+
+func TestCreateHandlerRequestTimeout(t *testing.T) {
+	config := &Config{Symbol: "AAPL", NDays: 5, Order: OrderDescending, MaxDays: 100, RequestTimeout: 20 * time.Millisecond}
+	provider := &MockProvider{
+		DailyBarsFunc: func(ctx context.Context, symbol string, nDays int) ([]TimeSeriesData, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}
+
+	recorder := httptest.NewRecorder()
+	createHandler(config, provider).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if recorder.Code != http.StatusGatewayTimeout {
+		t.Errorf("Expected status code %d, got %d", http.StatusGatewayTimeout, recorder.Code)
+	}
+	var response ErrorResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode error response: %v", err)
+	}
+	if response.Error.Code != errorCodeUpstreamTimeout {
+		t.Errorf("Expected error code %q, got %q", errorCodeUpstreamTimeout, response.Error.Code)
+	}
+}
+
+func TestCreateHandlerClientGone(t *testing.T) {
+	config := &Config{Symbol: "AAPL", NDays: 5, Order: OrderDescending, MaxDays: 100, RequestTimeout: time.Minute}
+	upstreamCancelled := make(chan struct{})
+	provider := &MockProvider{
+		DailyBarsFunc: func(ctx context.Context, symbol string, nDays int) ([]TimeSeriesData, error) {
+			<-ctx.Done()
+			close(upstreamCancelled)
+			return nil, ctx.Err()
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	recorder := httptest.NewRecorder()
+	createHandler(config, provider).ServeHTTP(recorder, req)
+
+	select {
+	case <-upstreamCancelled:
+	default:
+		t.Error("Expected the upstream call to be cancelled with the request")
+	}
+	if recorder.Body.Len() != 0 {
+		t.Errorf("Expected nothing to be written to a client that went away, got %q", recorder.Body.String())
+	}
+}
+
+func TestErrorEnvelopeForRequestErrors(t *testing.T) {
+	config := &Config{Symbol: "AAPL", NDays: 5, Order: OrderDescending, MaxDays: 100, BatchWorkers: 1}
+	provider := &MockProvider{
+		DailyBarsFunc: func(ctx context.Context, symbol string, nDays int) ([]TimeSeriesData, error) {
+			return nil, fmt.Errorf("unexpected provider call")
+		},
+	}
+
+	tests := []struct {
+		name           string
+		handler        http.Handler
+		method         string
+		target         string
+		expectedStatus int
+		expectedCode   string
+	}{
+		{
+			name:           "Stock handler method not allowed",
+			handler:        createHandler(config, provider),
+			method:         http.MethodPost,
+			target:         "/",
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedCode:   errorCodeMethodNotAllowed,
+		},
+		{
+			name:           "Stock handler invalid parameter",
+			handler:        createHandler(config, provider),
+			method:         http.MethodGet,
+			target:         "/?days=0",
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   errorCodeInvalidParameter,
+		},
+		{
+			name:           "Quotes handler method not allowed",
+			handler:        createQuotesHandler(config, provider),
+			method:         http.MethodDelete,
+			target:         "/v1/quotes",
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedCode:   errorCodeMethodNotAllowed,
+		},
+		{
+			name:           "Quotes handler invalid parameter",
+			handler:        createQuotesHandler(config, provider),
+			method:         http.MethodGet,
+			target:         "/v1/quotes?symbols=",
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   errorCodeInvalidParameter,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			req.Header.Set(requestIDHeader, "client-supplied-id")
+
+			recorder := httptest.NewRecorder()
+			tt.handler.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", tt.expectedStatus, recorder.Code)
+			}
+
+			var response ErrorResponse
+			if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode error response: %v", err)
+			}
+			if response.Error.Code != tt.expectedCode {
+				t.Errorf("Expected error code %q, got %q", tt.expectedCode, response.Error.Code)
+			}
+			if response.Error.RequestID != "client-supplied-id" {
+				t.Errorf("Expected the caller's request ID, got %q", response.Error.RequestID)
+			}
+			if response.Error.Retryable {
+				t.Error("Expected request errors not to be retryable")
+			}
+		})
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	generated := requestID(req)
+	if len(generated) != 32 {
+		t.Errorf("Expected a generated 32 character ID, got %q", generated)
+	}
+	if requestID(req) == generated {
+		t.Error("Expected generated IDs to be unique")
+	}
+
+	req.Header.Set(requestIDHeader, "abc-123")
+	if id := requestID(req); id != "abc-123" {
+		t.Errorf("Expected the caller's ID, got %q", id)
+	}
+
+	req.Header.Set(requestIDHeader, "bad id\nInjected: header")
+	if id := requestID(req); id == req.Header.Get(requestIDHeader) {
+		t.Error("Expected a malformed caller ID to be replaced")
+	}
+}
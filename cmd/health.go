@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Statuses reported by the health endpoints
+const (
+	healthOK   = "ok"
+	healthFail = "fail"
+)
+
+// HealthResponse is the API response format for the health endpoints
+type HealthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]HealthCheck `json:"checks,omitempty"`
+}
+
+// HealthCheck is the result of checking one component
+type HealthCheck struct {
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// upstreamFailureWindow is how long a failed upstream call keeps the
+// service unready. The probe never calls the upstream and an unready pod
+// gets no traffic, so a failure that never expired could never be cleared.
+const upstreamFailureWindow = 30 * time.Second
+
+// UpstreamMonitor records the outcome of upstream calls so that readiness
+// can be judged without making any. A nil *UpstreamMonitor records nothing.
+type UpstreamMonitor struct {
+	mu       sync.Mutex
+	observed bool
+	lastErr  error
+	failedAt time.Time
+	// now is the clock, time.Now when nil
+	now func() time.Time
+}
+
+// clock returns the current time from the monitor's clock
+func (m *UpstreamMonitor) clock() time.Time {
+	if m.now == nil {
+		return time.Now()
+	}
+	return m.now()
+}
+
+// Observe records the outcome of an upstream call
+func (m *UpstreamMonitor) Observe(err error) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.observed = true
+	m.lastErr = err
+	if err != nil {
+		m.failedAt = m.clock()
+	}
+}
+
+// checks returns the config and upstream checks implied by the last
+// upstream call. A failure older than upstreamFailureWindow no longer
+// counts, so that the service becomes ready again to try the upstream.
+// Error text is left out as it may contain request URLs.
+func (m *UpstreamMonitor) checks() (config, upstream HealthCheck) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	config = HealthCheck{Status: healthOK}
+	switch {
+	case !m.observed:
+		return config, HealthCheck{Status: healthOK, Message: "no upstream calls yet"}
+	case m.lastErr == nil:
+		return config, HealthCheck{Status: healthOK, Message: "last upstream call succeeded"}
+	case m.clock().Sub(m.failedAt) >= upstreamFailureWindow:
+		return config, HealthCheck{Status: healthOK, Message: "no recent upstream failures"}
+	case errors.Is(m.lastErr, ErrInvalidAPIKey):
+		config = HealthCheck{Status: healthFail, Message: "upstream rejected the API key"}
+		return config, HealthCheck{Status: healthOK, Message: "upstream reachable"}
+	case errors.Is(m.lastErr, ErrInvalidSymbol), errors.Is(m.lastErr, ErrRateLimited):
+		return config, HealthCheck{Status: healthOK, Message: "upstream reachable"}
+	default:
+		return config, HealthCheck{Status: healthFail, Message: "last upstream call failed"}
+	}
+}
+
+// monitoredProvider is a Provider that reports every call to an
+// UpstreamMonitor and to the upstream metrics
+type monitoredProvider struct {
+	Provider Provider
+	Monitor  *UpstreamMonitor
+	Metrics  *Metrics
+}
+
+// Name implements the Provider interface
+func (p *monitoredProvider) Name() string {
+	return p.Provider.Name()
+}
+
+// DailyBars implements the Provider interface. Calls abandoned by the
+// caller say nothing about the upstream and are not recorded.
+func (p *monitoredProvider) DailyBars(ctx context.Context, symbol string, nDays int) ([]TimeSeriesData, error) {
+	start := time.Now()
+	bars, err := p.Provider.DailyBars(ctx, symbol, nDays)
+	p.Metrics.ObserveUpstream(p.Provider.Name(), err, time.Since(start))
+	if !errors.Is(err, context.Canceled) {
+		p.Monitor.Observe(err)
+	}
+	return bars, err
+}
+
+// warmer is implemented by providers that can report whether they hold
+// data to serve without calling the upstream
+type warmer interface {
+	Warm() bool
+}
+
+// createHealthHandler creates the HTTP handler for the liveness probe. It
+// only reports that the process is serving requests.
+func createHealthHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, r, http.MethodGet)
+			return
+		}
+		writeHealth(w, http.StatusOK, HealthResponse{Status: healthOK})
+	}
+}
+
+// createReadyHandler creates the HTTP handler for the readiness probe. The
+// service is ready while it is not shutting down, the upstream has not
+// rejected its API key, and it can serve data either from a warm cache or
+// from an upstream that is reachable within the rate limit budget. The
+// probe never calls the upstream itself.
+func createReadyHandler(ctx context.Context, provider Provider, limiter *RateLimiter, monitor *UpstreamMonitor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, r, http.MethodGet)
+			return
+		}
+
+		checks := make(map[string]HealthCheck)
+
+		checks["shutdown"] = HealthCheck{Status: healthOK}
+		if ctx.Err() != nil {
+			checks["shutdown"] = HealthCheck{Status: healthFail, Message: "draining in-flight requests"}
+		}
+
+		checks["config"], checks["upstream"] = monitor.checks()
+
+		checks["rate_limit"] = HealthCheck{Status: healthOK}
+		if !limiter.Available() {
+			checks["rate_limit"] = HealthCheck{Status: healthFail, Message: "outbound call budget exhausted"}
+		}
+
+		cacheWarm := false
+		if cache, ok := provider.(warmer); ok {
+			cacheWarm = cache.Warm()
+			checks["cache"] = HealthCheck{Status: healthOK}
+			if !cacheWarm {
+				checks["cache"] = HealthCheck{Status: healthFail, Message: "no cached data"}
+			}
+		}
+
+		canServe := cacheWarm || (checks["upstream"].Status == healthOK && checks["rate_limit"].Status == healthOK)
+		if checks["shutdown"].Status == healthOK && checks["config"].Status == healthOK && canServe {
+			writeHealth(w, http.StatusOK, HealthResponse{Status: healthOK, Checks: checks})
+			return
+		}
+		writeHealth(w, http.StatusServiceUnavailable, HealthResponse{Status: healthFail, Checks: checks})
+	}
+}
+
+// writeHealth writes a HealthResponse that caches and proxies must not store
+func writeHealth(w http.ResponseWriter, status int, response HealthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		slog.Error("Error encoding response", "error", err)
+	}
+}
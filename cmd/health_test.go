@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCreateHealthHandler(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	createHealthHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, recorder.Code)
+	}
+	var response HealthResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Status != healthOK {
+		t.Errorf("Expected status %q, got %q", healthOK, response.Status)
+	}
+}
+
+func TestCreateReadyHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		lastErr        error
+		observed       bool
+		warmCache      bool
+		spendBudget    bool
+		shuttingDown   bool
+		expectedStatus int
+		failingCheck   string
+	}{
+		{
+			name:           "Fresh start",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Upstream healthy",
+			observed:       true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Upstream failing with a cold cache",
+			observed:       true,
+			lastErr:        fmt.Errorf("%w: unexpected HTTP status 503", ErrUpstream),
+			expectedStatus: http.StatusServiceUnavailable,
+			failingCheck:   "upstream",
+		},
+		{
+			name:           "Upstream failing with a warm cache",
+			observed:       true,
+			lastErr:        fmt.Errorf("%w: unexpected HTTP status 503", ErrUpstream),
+			warmCache:      true,
+			expectedStatus: http.StatusOK,
+			failingCheck:   "upstream",
+		},
+		{
+			name:           "API key rejected",
+			observed:       true,
+			lastErr:        fmt.Errorf("%w: the parameter apikey is invalid", ErrInvalidAPIKey),
+			warmCache:      true,
+			expectedStatus: http.StatusServiceUnavailable,
+			failingCheck:   "config",
+		},
+		{
+			name:           "Budget exhausted with a cold cache",
+			spendBudget:    true,
+			expectedStatus: http.StatusServiceUnavailable,
+			failingCheck:   "rate_limit",
+		},
+		{
+			name:           "Shutting down",
+			warmCache:      true,
+			shuttingDown:   true,
+			expectedStatus: http.StatusServiceUnavailable,
+			failingCheck:   "shutdown",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			clock := &fakeClock{now: time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)}
+			cache := newTestCache(countingProvider(&calls, 0), clock)
+			if tt.warmCache {
+				if _, _, err := cache.CachedDailyBars(context.Background(), "AAPL", 5); err != nil {
+					t.Fatalf("Unexpected error warming the cache: %v", err)
+				}
+			}
+
+			limiter := newTestLimiter(RateLimits{PerMinute: 1}, RateLimitReject, 0, clock)
+			if tt.spendBudget {
+				if err := limiter.Wait(context.Background()); err != nil {
+					t.Fatalf("Unexpected error spending the budget: %v", err)
+				}
+			}
+
+			monitor := &UpstreamMonitor{}
+			if tt.observed {
+				monitor.Observe(tt.lastErr)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.shuttingDown {
+				cancel()
+			}
+
+			before := atomic.LoadInt32(&calls)
+			recorder := httptest.NewRecorder()
+			createReadyHandler(ctx, cache, limiter, monitor).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			if recorder.Code != tt.expectedStatus {
+				t.Errorf("Expected status code %d, got %d: %s", tt.expectedStatus, recorder.Code, recorder.Body.String())
+			}
+			if atomic.LoadInt32(&calls) != before {
+				t.Error("Expected the readiness probe not to call the upstream")
+			}
+
+			var response HealthResponse
+			if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			for _, name := range []string{"shutdown", "config", "upstream", "rate_limit", "cache"} {
+				check, ok := response.Checks[name]
+				if !ok {
+					t.Errorf("Expected a %q check, got %+v", name, response.Checks)
+					continue
+				}
+				if name == tt.failingCheck && check.Status != healthFail {
+					t.Errorf("Expected the %q check to fail, got %+v", name, check)
+				}
+			}
+		})
+	}
+}
+
+func TestReadyHandlerRecoversFromUpstreamFailure(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		failingCheck string
+	}{
+		{"Upstream error", errors.New("boom"), "upstream"},
+		{"API key rejected", fmt.Errorf("%w: the parameter apikey is invalid", ErrInvalidAPIKey), "config"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			clock := &fakeClock{now: time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)}
+			cache := newTestCache(countingProvider(&calls, 0), clock)
+			limiter := newTestLimiter(RateLimits{PerMinute: 5}, RateLimitReject, 0, clock)
+			monitor := &UpstreamMonitor{now: clock.Now}
+			handler := createReadyHandler(context.Background(), cache, limiter, monitor)
+
+			probe := func() (int, HealthResponse) {
+				recorder := httptest.NewRecorder()
+				handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+				var response HealthResponse
+				if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				return recorder.Code, response
+			}
+
+			monitor.Observe(tt.err)
+			code, response := probe()
+			if code != http.StatusServiceUnavailable || response.Checks[tt.failingCheck].Status != healthFail {
+				t.Fatalf("Expected the %q check to fail after the error, got %d %+v", tt.failingCheck, code, response.Checks)
+			}
+
+			clock.Advance(upstreamFailureWindow - time.Second)
+			if code, _ := probe(); code != http.StatusServiceUnavailable {
+				t.Errorf("Expected a recent failure to keep the service unready, got %d", code)
+			}
+
+			clock.Advance(time.Second)
+			if code, response := probe(); code != http.StatusOK {
+				t.Errorf("Expected the service to be ready once the failure expired, got %d %+v", code, response.Checks)
+			}
+			if atomic.LoadInt32(&calls) != 0 {
+				t.Errorf("Expected readiness to recover without upstream calls, got %d", calls)
+			}
+		})
+	}
+}
+
+func TestMonitoredProvider(t *testing.T) {
+	results := []error{nil, fmt.Errorf("%w: unexpected HTTP status 503", ErrUpstream), context.Canceled}
+	var call int
+	monitor := &UpstreamMonitor{}
+	provider := &monitoredProvider{
+		Provider: &MockProvider{
+			DailyBarsFunc: func(ctx context.Context, symbol string, nDays int) ([]TimeSeriesData, error) {
+				err := results[call]
+				call++
+				return nil, err
+			},
+		},
+		Monitor: monitor,
+	}
+
+	_, _ = provider.DailyBars(context.Background(), "AAPL", 5)
+	if _, upstream := monitor.checks(); upstream.Status != healthOK {
+		t.Errorf("Expected the upstream check to pass after a success, got %+v", upstream)
+	}
+
+	_, _ = provider.DailyBars(context.Background(), "AAPL", 5)
+	if _, upstream := monitor.checks(); upstream.Status != healthFail {
+		t.Errorf("Expected the upstream check to fail after an error, got %+v", upstream)
+	}
+
+	// A cancelled call does not clear the failure
+	_, _ = provider.DailyBars(context.Background(), "AAPL", 5)
+	if _, upstream := monitor.checks(); upstream.Status != healthFail {
+		t.Errorf("Expected a cancelled call to be ignored, got %+v", upstream)
+	}
+}
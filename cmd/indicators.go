@@ -0,0 +1,504 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Indicator names, used as query parameters and response keys
+const (
+	indicatorSMA   = "sma"
+	indicatorEMA   = "ema"
+	indicatorRSI   = "rsi"
+	indicatorMACD  = "macd"
+	indicatorBands = "bbands"
+)
+
+// unsupportedIndicatorParams are the stock data query parameters the
+// indicators endpoint rejects rather than ignores. The symbol comes from
+// the path.
+var unsupportedIndicatorParams = []string{"symbol", "stats", "returns", "volatility_window"}
+
+const (
+	// maxIndicatorPeriod is the longest period an indicator may use
+	maxIndicatorPeriod = 200
+	// maxBandWidth is the widest Bollinger Bands may be, in standard deviations
+	maxBandWidth = 10
+
+	defaultSMAPeriod   = 20
+	defaultEMAPeriod   = 20
+	defaultRSIPeriod   = 14
+	defaultMACDFast    = 12
+	defaultMACDSlow    = 26
+	defaultMACDSignal  = 9
+	defaultBandsPeriod = 20
+	defaultBandsWidth  = 2
+)
+
+// PeriodParams configures an indicator computed over a single period
+type PeriodParams struct {
+	Period int `json:"period"`
+}
+
+// MACDParams configures the MACD indicator
+type MACDParams struct {
+	Fast   int `json:"fast"`
+	Slow   int `json:"slow"`
+	Signal int `json:"signal"`
+}
+
+// BandParams configures Bollinger Bands
+type BandParams struct {
+	Period int `json:"period"`
+	// Width is how many standard deviations each outer band is from the middle
+	Width float64 `json:"stddev"`
+}
+
+// IndicatorParams selects the indicators to compute and their periods
+type IndicatorParams struct {
+	SMA            *PeriodParams `json:"sma,omitempty"`
+	EMA            *PeriodParams `json:"ema,omitempty"`
+	RSI            *PeriodParams `json:"rsi,omitempty"`
+	MACD           *MACDParams   `json:"macd,omitempty"`
+	BollingerBands *BandParams   `json:"bbands,omitempty"`
+}
+
+// IndicatorsResponse is the API response format for the indicators endpoint
+type IndicatorsResponse struct {
+	Symbol        string `json:"symbol"`
+	Days          int    `json:"days"`
+	AvailableDays int    `json:"available_days"`
+	// WarmupDays is how much history before the first day the indicators
+	// need for its values to be valid. It is fetched along with the days.
+	WarmupDays int              `json:"warmup_days"`
+	Indicators IndicatorParams  `json:"indicators"`
+	Data       []IndicatorPoint `json:"data"`
+	// Warnings lists the days dropped from the history the indicators were
+	// computed from, warm-up included, as a value may span any of them
+	Warnings []string `json:"warnings,omitempty"`
+
+	Stale      bool      `json:"stale,omitempty"`
+	AgeSeconds int64     `json:"age_seconds,omitempty"`
+	Cache      CacheInfo `json:"-"`
+}
+
+// IndicatorPoint holds the indicator values for one day. Values the
+// available history is too short for are left out.
+type IndicatorPoint struct {
+	Date           string     `json:"date"`
+	Close          Price      `json:"close"`
+	SMA            *Price     `json:"sma,omitempty"`
+	EMA            *Price     `json:"ema,omitempty"`
+	RSI            *float64   `json:"rsi,omitempty"`
+	MACD           *MACDPoint `json:"macd,omitempty"`
+	BollingerBands *BandPoint `json:"bbands,omitempty"`
+}
+
+// MACDPoint is the MACD line, its signal line and their difference
+type MACDPoint struct {
+	MACD      Price `json:"macd"`
+	Signal    Price `json:"signal"`
+	Histogram Price `json:"histogram"`
+}
+
+// BandPoint is the three Bollinger Bands for one day
+type BandPoint struct {
+	Upper  Price `json:"upper"`
+	Middle Price `json:"middle"`
+	Lower  Price `json:"lower"`
+}
+
+// defaultIndicatorParams selects every indicator with its usual periods
+func defaultIndicatorParams() IndicatorParams {
+	return IndicatorParams{
+		SMA:            &PeriodParams{Period: defaultSMAPeriod},
+		EMA:            &PeriodParams{Period: defaultEMAPeriod},
+		RSI:            &PeriodParams{Period: defaultRSIPeriod},
+		MACD:           &MACDParams{Fast: defaultMACDFast, Slow: defaultMACDSlow, Signal: defaultMACDSignal},
+		BollingerBands: &BandParams{Period: defaultBandsPeriod, Width: defaultBandsWidth},
+	}
+}
+
+// warmup returns how many days of history before the first day the
+// selected indicators need for its values to be valid
+func (p IndicatorParams) warmup() int {
+	var days int
+	if p.SMA != nil {
+		days = max(days, p.SMA.Period-1)
+	}
+	if p.EMA != nil {
+		days = max(days, p.EMA.Period-1)
+	}
+	if p.RSI != nil {
+		days = max(days, p.RSI.Period)
+	}
+	if p.MACD != nil {
+		days = max(days, p.MACD.Slow+p.MACD.Signal-2)
+	}
+	if p.BollingerBands != nil {
+		days = max(days, p.BollingerBands.Period-1)
+	}
+	return days
+}
+
+// parseIndicatorParams reads the indicator query parameters. Each one that
+// is present selects its indicator, with the periods given as a comma
+// separated list or the defaults when empty. When none is present every
+// indicator is computed with its defaults.
+func parseIndicatorParams(values url.Values) (IndicatorParams, error) {
+	var params IndicatorParams
+	var err error
+
+	period := func(name string, fallback int) *PeriodParams {
+		if err != nil || !values.Has(name) {
+			return nil
+		}
+		var periods []int
+		if periods, err = parsePeriods(values.Get(name), fallback); err != nil {
+			err = &QueryError{Param: name, Message: err.Error()}
+			return nil
+		}
+		return &PeriodParams{Period: periods[0]}
+	}
+	params.SMA = period(indicatorSMA, defaultSMAPeriod)
+	params.EMA = period(indicatorEMA, defaultEMAPeriod)
+	params.RSI = period(indicatorRSI, defaultRSIPeriod)
+	if err != nil {
+		return IndicatorParams{}, err
+	}
+
+	if values.Has(indicatorMACD) {
+		periods, err := parsePeriods(values.Get(indicatorMACD), defaultMACDFast, defaultMACDSlow, defaultMACDSignal)
+		if err == nil && periods[0] >= periods[1] {
+			err = fmt.Errorf("the fast period must be shorter than the slow period, got %d and %d", periods[0], periods[1])
+		}
+		if err != nil {
+			return IndicatorParams{}, &QueryError{Param: indicatorMACD, Message: err.Error()}
+		}
+		params.MACD = &MACDParams{Fast: periods[0], Slow: periods[1], Signal: periods[2]}
+	}
+
+	if values.Has(indicatorBands) {
+		bands, err := parseBandParams(values.Get(indicatorBands))
+		if err != nil {
+			return IndicatorParams{}, &QueryError{Param: indicatorBands, Message: err.Error()}
+		}
+		params.BollingerBands = bands
+	}
+
+	if params == (IndicatorParams{}) {
+		return defaultIndicatorParams(), nil
+	}
+	return params, nil
+}
+
+// parsePeriods parses a comma separated list of as many periods as there
+// are defaults, returning the defaults when s is empty
+func parsePeriods(s string, defaults ...int) ([]int, error) {
+	if strings.TrimSpace(s) == "" {
+		return defaults, nil
+	}
+
+	parts := strings.Split(s, ",")
+	if len(parts) != len(defaults) {
+		return nil, fmt.Errorf("must be %d comma separated periods, got %q", len(defaults), s)
+	}
+	periods := make([]int, len(parts))
+	for i, part := range parts {
+		period, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || period < 1 || period > maxIndicatorPeriod {
+			return nil, fmt.Errorf("periods must be between 1 and %d, got %q", maxIndicatorPeriod, part)
+		}
+		periods[i] = period
+	}
+	return periods, nil
+}
+
+// parseBandParams parses a Bollinger Bands period, optionally followed by
+// the band width in standard deviations
+func parseBandParams(s string) (*BandParams, error) {
+	bands := &BandParams{Period: defaultBandsPeriod, Width: defaultBandsWidth}
+	if strings.TrimSpace(s) == "" {
+		return bands, nil
+	}
+
+	period, width, hasWidth := strings.Cut(s, ",")
+	periods, err := parsePeriods(period, defaultBandsPeriod)
+	if err != nil {
+		return nil, err
+	}
+	bands.Period = periods[0]
+
+	if hasWidth {
+		bands.Width, err = strconv.ParseFloat(strings.TrimSpace(width), 64)
+		if err != nil || !(bands.Width > 0 && bands.Width <= maxBandWidth) {
+			return nil, fmt.Errorf("the width must be more than 0 and at most %d standard deviations, got %q", maxBandWidth, width)
+		}
+	}
+	return bands, nil
+}
+
+// fetchIndicators computes the indicators in params for the days query
+// asks for, fetching the extra history the indicators need to warm up
+func fetchIndicators(ctx context.Context, provider Provider, query stockQuery, params IndicatorParams) (*IndicatorsResponse, error) {
+	warmup := params.warmup()
+	history, err := fetchStockData(ctx, provider, stockQuery{Symbol: query.Symbol, Days: query.Days + warmup, Order: OrderAscending})
+	if err != nil {
+		return nil, err
+	}
+
+	points := computeIndicators(history.Data, params, query.Rounding)
+	points = points[max(0, len(points)-query.Days):]
+
+	if query.Order == OrderDescending {
+		slices.Reverse(points)
+	}
+
+	return &IndicatorsResponse{
+		Symbol:        query.Symbol,
+		Days:          query.Days,
+		AvailableDays: len(points),
+		WarmupDays:    warmup,
+		Indicators:    params,
+		Data:          points,
+		Warnings:      history.Warnings,
+		Stale:         history.Stale,
+		AgeSeconds:    history.AgeSeconds,
+		Cache:         history.Cache,
+	}, nil
+}
+
+// computeIndicators computes the selected indicators for each of the bars,
+// which must be sorted oldest first, rounding prices as r says
+func computeIndicators(bars []TimeSeriesData, params IndicatorParams, r Rounding) []IndicatorPoint {
+	closes := make([]float64, len(bars))
+	points := make([]IndicatorPoint, len(bars))
+	for i, bar := range bars {
+		closes[i] = float64(bar.ClosePrice) / priceScale
+		points[i] = IndicatorPoint{Date: bar.Date, Close: bar.ClosePrice}
+	}
+
+	if params.SMA != nil {
+		for i, value := range movingAverage(closes, params.SMA.Period) {
+			points[i].SMA = optionalPrice(value, r)
+		}
+	}
+
+	if params.EMA != nil {
+		for i, value := range expMovingAverage(closes, params.EMA.Period) {
+			points[i].EMA = optionalPrice(value, r)
+		}
+	}
+
+	if params.RSI != nil {
+		for i, value := range relativeStrength(closes, params.RSI.Period) {
+			if !math.IsNaN(value) {
+				rsi := math.Round(value*100) / 100
+				points[i].RSI = &rsi
+			}
+		}
+	}
+
+	if params.MACD != nil {
+		fast := expMovingAverage(closes, params.MACD.Fast)
+		slow := expMovingAverage(closes, params.MACD.Slow)
+		line := make([]float64, len(closes))
+		for i := range line {
+			line[i] = fast[i] - slow[i]
+		}
+		for i, signal := range expMovingAverage(line, params.MACD.Signal) {
+			if !math.IsNaN(signal) {
+				points[i].MACD = &MACDPoint{
+					MACD:      priceFromFloat(line[i], r),
+					Signal:    priceFromFloat(signal, r),
+					Histogram: priceFromFloat(line[i]-signal, r),
+				}
+			}
+		}
+	}
+
+	if params.BollingerBands != nil {
+		period := params.BollingerBands.Period
+		for i, middle := range movingAverage(closes, period) {
+			if math.IsNaN(middle) {
+				continue
+			}
+			var variance float64
+			for _, value := range closes[i-period+1 : i+1] {
+				variance += math.Pow(value-middle, 2)
+			}
+			width := params.BollingerBands.Width * math.Sqrt(variance/float64(period))
+			points[i].BollingerBands = &BandPoint{
+				Upper:  priceFromFloat(middle+width, r),
+				Middle: priceFromFloat(middle, r),
+				Lower:  priceFromFloat(middle-width, r),
+			}
+		}
+	}
+
+	return points
+}
+
+// optionalPrice converts an indicator value to a Price, or nil when the
+// value is not yet valid
+func optionalPrice(value float64, r Rounding) *Price {
+	if math.IsNaN(value) {
+		return nil
+	}
+	price := priceFromFloat(value, r)
+	return &price
+}
+
+// nanSeries returns n values that are not yet valid
+func nanSeries(n int) []float64 {
+	series := make([]float64, n)
+	for i := range series {
+		series[i] = math.NaN()
+	}
+	return series
+}
+
+// movingAverage returns the simple moving average of values over period,
+// valid from the period'th value
+func movingAverage(values []float64, period int) []float64 {
+	averages := nanSeries(len(values))
+	var sum float64
+	for i, value := range values {
+		sum += value
+		if i >= period {
+			sum -= values[i-period]
+		}
+		if i >= period-1 {
+			averages[i] = sum / float64(period)
+		}
+	}
+	return averages
+}
+
+// expMovingAverage returns the exponential moving average of values over
+// period. Leading values that are not yet valid are skipped, and the
+// average is seeded with the simple average of the first period values.
+func expMovingAverage(values []float64, period int) []float64 {
+	averages := nanSeries(len(values))
+	start := 0
+	for start < len(values) && math.IsNaN(values[start]) {
+		start++
+	}
+	if len(values)-start < period {
+		return averages
+	}
+
+	var average float64
+	for _, value := range values[start : start+period] {
+		average += value
+	}
+	average /= float64(period)
+	averages[start+period-1] = average
+
+	alpha := 2 / float64(period+1)
+	for i := start + period; i < len(values); i++ {
+		average += alpha * (values[i] - average)
+		averages[i] = average
+	}
+	return averages
+}
+
+// relativeStrength returns Wilder's relative strength index of values over
+// period, valid once period changes have been seen
+func relativeStrength(values []float64, period int) []float64 {
+	rsi := nanSeries(len(values))
+	if len(values) <= period {
+		return rsi
+	}
+
+	var gain, loss float64
+	for i := 1; i < len(values); i++ {
+		change := values[i] - values[i-1]
+		up, down := max(change, 0), max(-change, 0)
+		if i <= period {
+			gain += up / float64(period)
+			loss += down / float64(period)
+			if i < period {
+				continue
+			}
+		} else {
+			gain = (gain*float64(period-1) + up) / float64(period)
+			loss = (loss*float64(period-1) + down) / float64(period)
+		}
+
+		switch {
+		case loss == 0 && gain == 0:
+			rsi[i] = 50
+		case loss == 0:
+			rsi[i] = 100
+		default:
+			rsi[i] = 100 - 100/(1+gain/loss)
+		}
+	}
+	return rsi
+}
+
+// createIndicatorsHandler creates the HTTP handler for the technical
+// indicators endpoint
+func createIndicatorsHandler(config *Config, provider Provider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, r, http.MethodGet)
+			return
+		}
+
+		symbol, err := parseSymbol(r.PathValue("symbol"))
+		if err != nil {
+			writeBadRequest(w, r, &QueryError{Param: "symbol", Message: err.Error()})
+			return
+		}
+
+		values := r.URL.Query()
+		for _, param := range unsupportedIndicatorParams {
+			if values.Has(param) {
+				writeBadRequest(w, r, &QueryError{Param: param, Message: "not supported by the indicators endpoint"})
+				return
+			}
+		}
+
+		query := defaultStockQuery(config)
+		query.Symbol = symbol
+		if err := parseDaysAndOrder(values, config, &query); err != nil {
+			writeBadRequest(w, r, err)
+			return
+		}
+
+		params, err := parseIndicatorParams(values)
+		if err != nil {
+			writeBadRequest(w, r, err)
+			return
+		}
+
+		setRequestQuery(r.Context(), query.Symbol, query.Days)
+
+		ctx, cancel := requestContext(r, config.RequestTimeout)
+		defer cancel()
+
+		response, err := fetchIndicators(ctx, provider, query, params)
+		if err != nil {
+			setRequestOutcome(r.Context(), upstreamOutcome(err), "")
+			writeUpstreamError(w, r, err)
+			return
+		}
+		setRequestOutcome(r.Context(), upstreamOutcome(nil), response.Cache.Status)
+
+		setCacheHeaders(w, response.Cache)
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding response", "error", err)
+		}
+	}
+}
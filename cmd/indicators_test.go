@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// indicatorBars returns n days of bars oldest first, with closes rising by
+// one from 100 and a dip every third day
+func indicatorBars(n int) []TimeSeriesData {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	bars := make([]TimeSeriesData, n)
+	for i := range bars {
+		closePrice := Price(100+i) * priceScale
+		if i%3 == 2 {
+			closePrice -= 2 * priceScale
+		}
+		bars[i] = TimeSeriesData{
+			Date:       start.AddDate(0, 0, i).Format(tradingDateLayout),
+			HighPrice:  closePrice + priceScale,
+			LowPrice:   closePrice - priceScale,
+			ClosePrice: closePrice,
+			Volume:     1000,
+		}
+	}
+	return bars
+}
+
+// assertSeries compares a computed series with the expected values, where
+// NaN means not yet valid
+func assertSeries(t *testing.T, expected, got []float64) {
+	t.Helper()
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %d values, got %d", len(expected), len(got))
+	}
+	for i := range expected {
+		if math.IsNaN(expected[i]) != math.IsNaN(got[i]) || math.Abs(expected[i]-got[i]) > 1e-9 {
+			t.Errorf("Value %d: expected %v, got %v", i, expected[i], got[i])
+		}
+	}
+}
+
+func TestIndicatorSeries(t *testing.T) {
+	nan := math.NaN()
+
+	t.Run("Simple moving average", func(t *testing.T) {
+		assertSeries(t, []float64{nan, nan, 2, 3, 4}, movingAverage([]float64{1, 2, 3, 4, 5}, 3))
+	})
+	t.Run("Exponential moving average", func(t *testing.T) {
+		assertSeries(t, []float64{nan, nan, 2, 3, 4}, expMovingAverage([]float64{1, 2, 3, 4, 5}, 3))
+	})
+	t.Run("Exponential moving average skips leading invalid values", func(t *testing.T) {
+		assertSeries(t, []float64{nan, nan, 3, 5}, expMovingAverage([]float64{nan, 2, 4, 6}, 2))
+	})
+	t.Run("Exponential moving average of a short series", func(t *testing.T) {
+		assertSeries(t, []float64{nan, nan}, expMovingAverage([]float64{1, 2}, 3))
+	})
+	t.Run("Relative strength", func(t *testing.T) {
+		assertSeries(t, []float64{nan, nan, 100, 50, 75}, relativeStrength([]float64{1, 2, 3, 2, 3}, 2))
+	})
+	t.Run("Relative strength of a flat series", func(t *testing.T) {
+		assertSeries(t, []float64{nan, 50, 50}, relativeStrength([]float64{5, 5, 5}, 1))
+	})
+}
+
+func TestParseIndicatorParams(t *testing.T) {
+	tests := []struct {
+		name          string
+		rawQuery      string
+		expected      IndicatorParams
+		expectedParam string
+	}{
+		{name: "Every indicator by default", rawQuery: "days=5", expected: defaultIndicatorParams()},
+		{
+			name:     "Selected indicators with defaults",
+			rawQuery: "sma&rsi=",
+			expected: IndicatorParams{SMA: &PeriodParams{Period: defaultSMAPeriod}, RSI: &PeriodParams{Period: defaultRSIPeriod}},
+		},
+		{
+			name:     "Custom periods",
+			rawQuery: "ema=50&macd=5,35,5&bbands=10,1.5",
+			expected: IndicatorParams{
+				EMA:            &PeriodParams{Period: 50},
+				MACD:           &MACDParams{Fast: 5, Slow: 35, Signal: 5},
+				BollingerBands: &BandParams{Period: 10, Width: 1.5},
+			},
+		},
+		{
+			name:     "Bollinger Bands period only",
+			rawQuery: "bbands=30",
+			expected: IndicatorParams{BollingerBands: &BandParams{Period: 30, Width: defaultBandsWidth}},
+		},
+		{name: "Period not a number", rawQuery: "sma=ten", expectedParam: indicatorSMA},
+		{name: "Period too long", rawQuery: "ema=201", expectedParam: indicatorEMA},
+		{name: "Period zero", rawQuery: "rsi=0", expectedParam: indicatorRSI},
+		{name: "Too many periods", rawQuery: "sma=10,20", expectedParam: indicatorSMA},
+		{name: "MACD needs three periods", rawQuery: "macd=12,26", expectedParam: indicatorMACD},
+		{name: "MACD fast not shorter than slow", rawQuery: "macd=26,12,9", expectedParam: indicatorMACD},
+		{name: "Band width not positive", rawQuery: "bbands=20,0", expectedParam: indicatorBands},
+		{name: "Band width too wide", rawQuery: "bbands=20,11", expectedParam: indicatorBands},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.rawQuery)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			params, err := parseIndicatorParams(values)
+			if tt.expectedParam != "" {
+				var queryErr *QueryError
+				if !errors.As(err, &queryErr) {
+					t.Fatalf("Expected *QueryError, got %v", err)
+				}
+				if queryErr.Param != tt.expectedParam {
+					t.Errorf("Expected error for %s, got %s", tt.expectedParam, queryErr.Param)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(params, tt.expected) {
+				got, _ := json.Marshal(params)
+				expected, _ := json.Marshal(tt.expected)
+				t.Errorf("Expected %s, got %s", expected, got)
+			}
+		})
+	}
+}
+
+func TestIndicatorWarmup(t *testing.T) {
+	tests := []struct {
+		name     string
+		params   IndicatorParams
+		expected int
+	}{
+		{"Defaults are led by MACD", defaultIndicatorParams(), 33},
+		{"SMA", IndicatorParams{SMA: &PeriodParams{Period: 50}}, 49},
+		{"RSI needs one more day for its first change", IndicatorParams{RSI: &PeriodParams{Period: 14}}, 14},
+		{"Bollinger Bands", IndicatorParams{BollingerBands: &BandParams{Period: 20, Width: 2}}, 19},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.params.warmup(); got != tt.expected {
+				t.Errorf("Expected warmup %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestComputeIndicators(t *testing.T) {
+	bars := indicatorBars(6)
+	bars[3].ClosePrice, bars[4].ClosePrice, bars[5].ClosePrice = bars[2].ClosePrice, bars[2].ClosePrice, bars[2].ClosePrice
+	params := IndicatorParams{
+		SMA:            &PeriodParams{Period: 3},
+		BollingerBands: &BandParams{Period: 3, Width: 2},
+		MACD:           &MACDParams{Fast: 2, Slow: 3, Signal: 2},
+	}
+
+	points := computeIndicators(bars, params, Rounding{})
+
+	if points[1].SMA != nil || points[1].BollingerBands != nil {
+		t.Errorf("Expected no values before the period is complete, got %+v", points[1])
+	}
+	if points[2].SMA == nil || *points[2].SMA != testPrice("100.3333") {
+		t.Errorf("Expected SMA 100.3333 on the third day, got %v", points[2].SMA)
+	}
+	if points[2].MACD != nil || points[3].MACD == nil {
+		t.Errorf("Expected MACD from the fourth day, got %+v and %+v", points[2].MACD, points[3].MACD)
+	}
+
+	expectedBands := &BandPoint{Upper: testPrice("100"), Middle: testPrice("100"), Lower: testPrice("100")}
+	if !reflect.DeepEqual(points[5].BollingerBands, expectedBands) {
+		t.Errorf("Expected flat bands %+v once the closes are flat, got %+v", expectedBands, points[5].BollingerBands)
+	}
+}
+
+func TestFetchIndicatorsWarmsUp(t *testing.T) {
+	tests := []struct {
+		name      string
+		available int
+		days      int
+		order     SortOrder
+		valid     int
+	}{
+		{name: "Enough history", available: 200, days: 10, order: OrderDescending, valid: 10},
+		{name: "Ascending order", available: 200, days: 10, order: OrderAscending, valid: 10},
+		{name: "History shorter than the warmup", available: 40, days: 10, order: OrderAscending, valid: 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requested int
+			provider := &MockProvider{
+				DailyBarsFunc: func(ctx context.Context, symbol string, nDays int) ([]TimeSeriesData, error) {
+					requested = nDays
+					return indicatorBars(tt.available), nil
+				},
+			}
+
+			params := defaultIndicatorParams()
+			query := stockQuery{Symbol: "MSFT", Days: tt.days, Order: tt.order}
+			response, err := fetchIndicators(context.Background(), provider, query, params)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if requested != tt.days+params.warmup() || response.WarmupDays != params.warmup() {
+				t.Errorf("Expected %d days of history to be requested, got %d", tt.days+params.warmup(), requested)
+			}
+			if len(response.Data) != tt.days || response.AvailableDays != tt.days {
+				t.Fatalf("Expected %d points, got %d", tt.days, len(response.Data))
+			}
+
+			newest := indicatorBars(tt.available)[tt.available-1].Date
+			if first, last := response.Data[0].Date, response.Data[tt.days-1].Date; (tt.order == OrderDescending) != (first == newest) || first == last {
+				t.Errorf("Expected %s order, got %s to %s", tt.order, first, last)
+			}
+
+			var valid int
+			for _, point := range response.Data {
+				if point.SMA != nil && point.EMA != nil && point.RSI != nil && point.MACD != nil && point.BollingerBands != nil {
+					valid++
+				}
+			}
+			if valid != tt.valid {
+				t.Errorf("Expected %d points with every indicator, got %d", tt.valid, valid)
+			}
+		})
+	}
+}
+
+func TestFetchIndicatorsWarnings(t *testing.T) {
+	provider := &MockProvider{
+		DailyBarsFunc: func(ctx context.Context, symbol string, nDays int) ([]TimeSeriesData, error) {
+			bars := indicatorBars(60)
+			bars[50].invalidate("missing close")
+			bars[58].invalidate("missing close")
+			return bars, nil
+		},
+	}
+
+	params := IndicatorParams{SMA: &PeriodParams{Period: 10}}
+	query := stockQuery{Symbol: "MSFT", Days: 5, Order: OrderDescending}
+	response, err := fetchIndicators(context.Background(), provider, query, params)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []string{"2024-02-28 dropped: missing close", "2024-02-20 dropped: missing close"}
+	if !reflect.DeepEqual(response.Warnings, expected) {
+		t.Errorf("Expected the days dropped from the returned range and the warm-up history, got %q", response.Warnings)
+	}
+}
+
+func TestCreateIndicatorsHandler(t *testing.T) {
+	config := &Config{Symbol: "AAPL", NDays: 5, Order: OrderDescending, MaxDays: 100}
+	provider := &MockProvider{
+		DailyBarsFunc: func(ctx context.Context, symbol string, nDays int) ([]TimeSeriesData, error) {
+			if symbol == "GOOG" {
+				return nil, fmt.Errorf("%w: Invalid API call", ErrInvalidSymbol)
+			}
+			return indicatorBars(nDays), nil
+		},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/indicators/{symbol}", createIndicatorsHandler(config, provider))
+
+	tests := []struct {
+		name           string
+		method         string
+		target         string
+		expectedStatus int
+	}{
+		{name: "Default indicators", method: http.MethodGet, target: "/v1/indicators/msft", expectedStatus: http.StatusOK},
+		{name: "Selected indicators", method: http.MethodGet, target: "/v1/indicators/MSFT?sma=10&days=30", expectedStatus: http.StatusOK},
+		{name: "Invalid symbol", method: http.MethodGet, target: "/v1/indicators/A$PL", expectedStatus: http.StatusBadRequest},
+		{name: "Invalid days", method: http.MethodGet, target: "/v1/indicators/MSFT?days=0", expectedStatus: http.StatusBadRequest},
+		{name: "Symbol in the query", method: http.MethodGet, target: "/v1/indicators/MSFT?symbol=AAPL", expectedStatus: http.StatusBadRequest},
+		{name: "Stats not supported", method: http.MethodGet, target: "/v1/indicators/MSFT?stats=all", expectedStatus: http.StatusBadRequest},
+		{name: "Returns not supported", method: http.MethodGet, target: "/v1/indicators/MSFT?returns=include", expectedStatus: http.StatusBadRequest},
+		{name: "Invalid period", method: http.MethodGet, target: "/v1/indicators/MSFT?rsi=0", expectedStatus: http.StatusBadRequest},
+		{name: "Unknown symbol upstream", method: http.MethodGet, target: "/v1/indicators/GOOG", expectedStatus: http.StatusNotFound},
+		{name: "POST not allowed", method: http.MethodPost, target: "/v1/indicators/MSFT", expectedStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, httptest.NewRequest(tt.method, tt.target, nil))
+
+			if recorder.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.expectedStatus, recorder.Code, recorder.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response IndicatorsResponse
+			if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Symbol != "MSFT" || len(response.Data) != response.Days {
+				t.Errorf("Expected %d points for MSFT, got %d for %s", response.Days, len(response.Data), response.Symbol)
+			}
+			if first := response.Data[len(response.Data)-1]; first.SMA == nil {
+				t.Errorf("Expected the oldest point to be warmed up, got %+v", first)
+			}
+		})
+	}
+}
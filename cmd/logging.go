@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// contextKey namespaces the values this package stores in a context
+type contextKey int
+
+const (
+	// requestIDKey holds the request ID assigned by instrumentHandler
+	requestIDKey contextKey = iota
+	// requestInfoKey holds the *requestInfo for the access log
+	requestInfoKey
+)
+
+// parseLogLevel parses a log level such as "debug" or "WARN", defaulting to
+// info when empty
+func parseLogLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if strings.TrimSpace(s) == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(s))); err != nil {
+		return 0, fmt.Errorf("invalid log level %q: must be debug, info, warn or error", s)
+	}
+	return level, nil
+}
+
+// newLogger returns a JSON logger writing to w at level. Every value that
+// contains one of secrets, or a credential query parameter, is redacted, and
+// records logged with a request context carry its request ID.
+func newLogger(w io.Writer, level slog.Leveler, secrets ...string) *slog.Logger {
+	redact := newRedactor(secrets)
+	handler := slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			switch a.Value.Kind() {
+			case slog.KindString:
+				a.Value = slog.StringValue(redact(a.Value.String()))
+			case slog.KindAny:
+				if err, ok := a.Value.Any().(error); ok {
+					a.Value = slog.StringValue(redact(err.Error()))
+				}
+			}
+			return a
+		},
+	})
+	return slog.New(&contextHandler{Handler: handler})
+}
+
+// contextHandler is a slog.Handler that adds the request ID from the
+// record's context
+type contextHandler struct {
+	slog.Handler
+}
+
+// Handle implements the slog.Handler interface
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id, ok := ctx.Value(requestIDKey).(string); ok {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+// WithAttrs implements the slog.Handler interface
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup implements the slog.Handler interface
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// requestInfo collects what a handler did for the request's access log line
+type requestInfo struct {
+	mu      sync.Mutex
+	symbol  string
+	days    int
+	cache   CacheStatus
+	outcome string
+}
+
+// setRequestQuery records the symbol and days a request asked for
+func setRequestQuery(ctx context.Context, symbol string, days int) {
+	if info, ok := ctx.Value(requestInfoKey).(*requestInfo); ok {
+		info.mu.Lock()
+		defer info.mu.Unlock()
+		info.symbol, info.days = symbol, days
+	}
+}
+
+// setRequestOutcome records how the upstream data for a request was served
+func setRequestOutcome(ctx context.Context, outcome string, cache CacheStatus) {
+	if info, ok := ctx.Value(requestInfoKey).(*requestInfo); ok {
+		info.mu.Lock()
+		defer info.mu.Unlock()
+		info.outcome, info.cache = outcome, cache
+	}
+}
+
+// attrs returns the access log attributes the handler recorded
+func (info *requestInfo) attrs() []slog.Attr {
+	info.mu.Lock()
+	defer info.mu.Unlock()
+
+	var attrs []slog.Attr
+	if info.symbol != "" {
+		attrs = append(attrs, slog.String("symbol", info.symbol), slog.Int("days", info.days))
+	}
+	if info.outcome != "" {
+		attrs = append(attrs, slog.String("upstream", info.outcome))
+	}
+	if info.cache != "" {
+		attrs = append(attrs, slog.String("cache", string(info.cache)))
+	}
+	return attrs
+}
+
+// logRequest writes the access log line for a request. The query string is
+// left out; what matters from it is recorded in info.
+func logRequest(r *http.Request, route string, status int, elapsed time.Duration, info *requestInfo) {
+	level := slog.LevelInfo
+	if status >= http.StatusInternalServerError {
+		level = slog.LevelWarn
+	}
+
+	attrs := []slog.Attr{
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.String("route", route),
+		slog.Int("status", status),
+		slog.Float64("latency_ms", float64(elapsed.Microseconds())/1000),
+	}
+	attrs = append(attrs, info.attrs()...)
+	slog.LogAttrs(r.Context(), level, "request", attrs...)
+}
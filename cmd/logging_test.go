@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// captureLogs sends the default logger to a buffer for the rest of the test
+func captureLogs(t *testing.T, secrets ...string) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(newLogger(&buf, slog.LevelDebug, secrets...))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+// logRecords decodes the JSON log lines in buf
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Expected a JSON log line, got %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestParseLogLevel(t *testing.T) {
+	for input, expected := range map[string]slog.Level{"": slog.LevelInfo, "debug": slog.LevelDebug, "WARN": slog.LevelWarn, "error": slog.LevelError} {
+		level, err := parseLogLevel(input)
+		if err != nil || level != expected {
+			t.Errorf("parseLogLevel(%q) = %v, %v; expected %v", input, level, err, expected)
+		}
+	}
+	if _, err := parseLogLevel("verbose"); err == nil {
+		t.Error("Expected error for invalid level, got nil")
+	}
+}
+
+func TestNewLoggerRedactsSecrets(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newLogger(&buf, slog.LevelInfo, "s3cr3t-key")
+
+	logger.Info("calling https://www.alphavantage.co/query?apikey=s3cr3t-key",
+		"url", "https://www.alphavantage.co/query?symbol=IBM&apikey=other-key&function=TIME_SERIES_DAILY",
+		"error", fmt.Errorf("Get %q: connection reset", "https://www.alphavantage.co/query?apikey=s3cr3t-key"),
+		slog.Group("upstream", "key", "s3cr3t-key"),
+	)
+
+	output := buf.String()
+	for _, secret := range []string{"s3cr3t-key", "other-key"} {
+		if strings.Contains(output, secret) {
+			t.Errorf("Expected %q to be redacted, got %s", secret, output)
+		}
+	}
+	if !strings.Contains(output, "symbol=IBM&apikey="+redactedValue+"&function") {
+		t.Errorf("Expected the rest of the URL to be kept, got %s", output)
+	}
+}
+
+func TestNewLoggerLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newLogger(&buf, slog.LevelWarn)
+
+	logger.Info("hidden")
+	logger.Warn("shown")
+	if strings.Contains(buf.String(), "hidden") || !strings.Contains(buf.String(), "shown") {
+		t.Errorf("Expected only warnings to be logged, got %s", buf.String())
+	}
+}
+
+func TestContextHandlerAddsRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newLogger(&buf, slog.LevelInfo).With("component", "test")
+
+	ctx := context.WithValue(context.Background(), requestIDKey, "req-42")
+	logger.InfoContext(ctx, "with id")
+	logger.Info("without id")
+
+	records := logRecords(t, &buf)
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 log records, got %d", len(records))
+	}
+	if records[0]["request_id"] != "req-42" || records[0]["component"] != "test" {
+		t.Errorf("Expected the request ID and logger attributes, got %v", records[0])
+	}
+	if _, ok := records[1]["request_id"]; ok {
+		t.Errorf("Expected no request ID without a request context, got %v", records[1])
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	buf := captureLogs(t, "test-api-key")
+
+	config := &Config{Symbol: "AAPL", NDays: 5, Order: OrderDescending, MaxDays: 100, APIKey: "test-api-key"}
+	provider := &MockProvider{
+		DailyBarsFunc: func(ctx context.Context, symbol string, nDays int) ([]TimeSeriesData, error) {
+			if symbol == "FAIL" {
+				return nil, fmt.Errorf("%w: Get \"https://www.alphavantage.co/query?apikey=test-api-key\": EOF", ErrUpstream)
+			}
+			return []TimeSeriesData{{Date: "2025-01-15", ClosePrice: testPrice("100")}}, nil
+		},
+	}
+	limiter := NewRateLimiter(RateLimits{}, RateLimitQueue, 0)
+	server := newServer(context.Background(), config, provider, limiter, &UpstreamMonitor{}, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/?symbol=msft&days=3", nil)
+	req.Header.Set(requestIDHeader, "client-id-1")
+	recorder := httptest.NewRecorder()
+	server.Handler.ServeHTTP(recorder, req)
+
+	if got := recorder.Header().Get(requestIDHeader); got != "client-id-1" {
+		t.Errorf("Expected the caller's request ID to be echoed, got %q", got)
+	}
+
+	recorder = httptest.NewRecorder()
+	server.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/?symbol=FAIL", nil))
+	generated := recorder.Header().Get(requestIDHeader)
+	var response ErrorResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode error response: %v", err)
+	}
+	if generated == "" || response.Error.RequestID != generated {
+		t.Errorf("Expected a generated request ID in the header and body, got %q and %q", generated, response.Error.RequestID)
+	}
+
+	if strings.Contains(buf.String(), "test-api-key") {
+		t.Errorf("Expected the API key to be redacted from logs, got %s", buf.String())
+	}
+
+	var access []map[string]any
+	var upstreamErrors []map[string]any
+	for _, record := range logRecords(t, buf) {
+		switch record["msg"] {
+		case "request":
+			access = append(access, record)
+		case "Upstream error":
+			upstreamErrors = append(upstreamErrors, record)
+		}
+	}
+	if len(access) != 2 {
+		t.Fatalf("Expected 2 access log records, got %d: %s", len(access), buf.String())
+	}
+
+	expected := map[string]any{
+		"request_id": "client-id-1",
+		"method":     "GET",
+		"path":       "/",
+		"route":      "/{$}",
+		"status":     float64(200),
+		"symbol":     "MSFT",
+		"days":       float64(3),
+		"upstream":   "ok",
+	}
+	for key, value := range expected {
+		if access[0][key] != value {
+			t.Errorf("Expected %s=%v in the access log, got %v", key, value, access[0][key])
+		}
+	}
+	if _, ok := access[0]["latency_ms"].(float64); !ok {
+		t.Errorf("Expected a numeric latency_ms, got %v", access[0]["latency_ms"])
+	}
+
+	if access[1]["request_id"] != generated || access[1]["status"] != float64(500) || access[1]["upstream"] != errorCodeUpstreamFailed {
+		t.Errorf("Expected the failed request to be logged with its outcome, got %v", access[1])
+	}
+	if len(upstreamErrors) != 1 || upstreamErrors[0]["request_id"] != generated {
+		t.Errorf("Expected the upstream error to be logged against the request ID, got %v", upstreamErrors)
+	}
+}
+
+func TestRequestInfoWithoutMiddleware(t *testing.T) {
+	// Handlers used without instrumentHandler must not fail
+	setRequestQuery(context.Background(), "AAPL", 5)
+	setRequestOutcome(context.Background(), "ok", CacheHit)
+
+	start := time.Now()
+	logRequest(httptest.NewRequest(http.MethodGet, "/", nil), "/{$}", http.StatusOK, time.Since(start), &requestInfo{})
+}
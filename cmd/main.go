@@ -1,219 +1,401 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
-	"strconv"
+	"sort"
+	"strings"
+	"time"
 )
 
 // TimeSeriesData represents a single day of stock data
 type TimeSeriesData struct {
-	Date       string  `json:"date"`
-	OpenPrice  float64 `json:"open"`
-	HighPrice  float64 `json:"high"`
-	LowPrice   float64 `json:"low"`
-	ClosePrice float64 `json:"close"`
-	Volume     int64   `json:"volume"`
+	Date       string `json:"date"`
+	OpenPrice  Price  `json:"open"`
+	HighPrice  Price  `json:"high"`
+	LowPrice   Price  `json:"low"`
+	ClosePrice Price  `json:"close"`
+	Volume     int64  `json:"volume"`
+
+	// Warnings flags values that parsed but look wrong, such as a close
+	// outside the day's range
+	Warnings []string `json:"warnings,omitempty"`
+	// Invalid marks a day the provider sent unusable values for, described
+	// by Warnings. Such days are left out of responses.
+	Invalid bool `json:"-"`
 }
 
-// StockResponse is the API response format
-type StockResponse struct {
-	Symbol       string           `json:"symbol"`
-	Days         int              `json:"days"`
-	AverageClose float64          `json:"average_close"`
-	Data         []TimeSeriesData `json:"data"`
+// invalidate marks the bar Invalid, recording why
+func (b *TimeSeriesData) invalidate(warning string) {
+	b.Invalid = true
+	b.Warnings = append(b.Warnings, warning)
 }
 
-// AlphaVantageResponse is the format returned by the Alpha Vantage API
-type AlphaVantageResponse struct {
-	MetaData   map[string]interface{}            `json:"Meta Data"`
-	TimeSeries map[string]map[string]interface{} `json:"Time Series (Daily)"`
+// StockResponse is the API response format
+type StockResponse struct {
+	Symbol string `json:"symbol"`
+	Days   int    `json:"days"`
+	// AvailableDays is how many of the requested days the provider had
+	// data for. It is less than Days when the symbol's history is shorter.
+	AvailableDays int `json:"available_days"`
+	// AverageClose is rounded as the configured AverageRounding says
+	AverageClose Price `json:"average_close"`
+	// Data is left out when the returns query parameter asks for returns
+	// only
+	Data []TimeSeriesData `json:"data,omitzero"`
+	// Returns holds the daily returns asked for by the returns query
+	// parameter, in the same order as Data
+	Returns []ReturnPoint `json:"returns,omitempty"`
+	// Stats holds the statistics selected by the stats query parameter
+	Stats *Stats `json:"stats,omitempty"`
+	// Warnings lists the days dropped from Data because the provider sent
+	// unusable values for them
+	Warnings []string `json:"warnings,omitempty"`
+
+	// Stale is set when cached data is served in place of a fresh upstream
+	// response, with AgeSeconds giving how old that data is
+	Stale      bool  `json:"stale,omitempty"`
+	AgeSeconds int64 `json:"age_seconds,omitempty"`
+
+	// Cache reports how the data was served and is sent as headers
+	Cache CacheInfo `json:"-"`
 }
 
 // Config holds the application configuration
 type Config struct {
-	Symbol string
-	NDays  int
-	APIKey string
+	Symbol       string
+	NDays        int
+	APIKey       Secret
+	Order        SortOrder
+	Provider     string
+	MaxDays      int
+	BatchWorkers int
+
+	// AverageRounding says how AverageClose is rounded
+	AverageRounding Rounding
+
+	// APIKeyFile is the file APIKey was read from, if any. It is re-read
+	// every SecretRefresh so a rotated key is picked up.
+	APIKeyFile    string
+	SecretRefresh time.Duration
+
+	CacheTTL      time.Duration
+	CacheStaleTTL time.Duration
+	CacheMaxStale time.Duration
+
+	RateLimits       RateLimits
+	RateLimitMode    RateLimitMode
+	RateLimitMaxWait time.Duration
+
+	RetryMaxAttempts int
+	RetryBaseDelay   time.Duration
+	RetryMaxDelay    time.Duration
+
+	UpstreamTimeout time.Duration
+	RequestTimeout  time.Duration
+
+	ListenAddr      string
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	ShutdownDelay   time.Duration
+	ShutdownTimeout time.Duration
+
+	LogLevel slog.Level
 }
 
-// HTTPClient interface allows us to mock the http.Client in tests
+const (
+	// defaultUpstreamTimeout bounds each upstream call, including reading
+	// the body, unless UPSTREAM_TIMEOUT says otherwise
+	defaultUpstreamTimeout = 10 * time.Second
+	// defaultRequestTimeout bounds the handling of a whole API request,
+	// including retries and rate limit waits, unless REQUEST_TIMEOUT says
+	// otherwise
+	defaultRequestTimeout = 30 * time.Second
+)
+
+// HTTPClient interface allows us to mock the http.Client in tests. The call
+// is abandoned when ctx is cancelled or its deadline passes.
 type HTTPClient interface {
-	Get(url string) (*http.Response, error)
+	Get(ctx context.Context, url string) (*http.Response, error)
 }
 
-// DefaultHTTPClient is the default implementation of HTTPClient
-type DefaultHTTPClient struct{}
-
-// Get implements the HTTPClient interface
-func (c *DefaultHTTPClient) Get(url string) (*http.Response, error) {
-	return http.Get(url)
+// DefaultHTTPClient is the default implementation of HTTPClient. A non-zero
+// Timeout bounds each call, including reading the response body.
+type DefaultHTTPClient struct {
+	Timeout time.Duration
 }
 
-func main() {
-	config, err := loadConfig()
+// Get implements the HTTPClient interface
+func (c *DefaultHTTPClient) Get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
+	client := &http.Client{Timeout: c.Timeout}
+	return client.Do(req)
+}
 
-	client := &DefaultHTTPClient{}
-	startServer(config, client)
+func main() {
+	slog.SetDefault(newLogger(os.Stderr, slog.LevelInfo))
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
 }
 
-// loadConfig loads configuration from environment variables
-func loadConfig() (*Config, error) {
-	symbol := os.Getenv("SYMBOL")
-	if symbol == "" {
-		return nil, fmt.Errorf("SYMBOL environment variable is required")
+// loadConfig loads the configuration from the config file at path, or at
+// CONFIG_FILE when path is empty, with environment variables and then
+// overrides, keyed by variable name, taking precedence. Every invalid
+// setting is reported in the returned error.
+func loadConfig(path string, overrides map[string]string) (*Config, error) {
+	if path == "" {
+		path = os.Getenv(configFileEnv)
 	}
-
-	nDaysStr := os.Getenv("NDAYS")
-	if nDaysStr == "" {
-		return nil, fmt.Errorf("NDAYS environment variable is required")
+	l := newConfigLoader(path, overrides)
+
+	symbol := parseRequired(l, "SYMBOL", parseSymbol)
+	maxDays := l.int("MAX_DAYS", defaultMaxDays, 1)
+	nDays := parseRequired(l, "NDAYS", func(s string) (int, error) { return parseDays(s, maxDays) })
+
+	apiKey := l.required("APIKEY")
+	apiKeyFile := l.valueFiles["APIKEY"]
+	switch {
+	case apiKeyFile != "":
+		warnIfExposed(apiKeyFile)
+	case l.fromFile["APIKEY"]:
+		warnIfExposed(path)
 	}
+	secretRefresh := l.duration("SECRET_REFRESH_INTERVAL", defaultSecretRefresh)
 
-	nDays, err := strconv.Atoi(nDaysStr)
-	if err != nil {
-		return nil, fmt.Errorf("Invalid NDAYS value: %v", err)
+	order := parseSetting(l, "ORDER", parseSortOrder)
+	provider := parseSetting(l, "PROVIDER", parseProviderName)
+	if provider == "" {
+		provider = defaultProvider
 	}
-
-	apiKey := os.Getenv("APIKEY")
-	if apiKey == "" {
-		return nil, fmt.Errorf("APIKEY environment variable is required")
+	batchWorkers := l.int("BATCH_WORKERS", defaultBatchWorkers, 1)
+	averageRounding := Rounding{
+		Mode:     parseSetting(l, "AVERAGE_ROUNDING", parseRoundingMode),
+		Decimals: parseSetting(l, "AVERAGE_DECIMALS", parseDecimals),
 	}
 
-	return &Config{
-		Symbol: symbol,
-		NDays:  nDays,
-		APIKey: apiKey,
-	}, nil
-}
-
-// startServer starts the HTTP server
-func startServer(config *Config, client HTTPClient) {
-	http.HandleFunc("/", createHandler(config, client))
+	config := &Config{
+		Symbol:        symbol,
+		NDays:         nDays,
+		APIKey:        Secret(apiKey),
+		APIKeyFile:    apiKeyFile,
+		SecretRefresh: secretRefresh,
+		Order:         order,
+		Provider:      provider,
+		MaxDays:       maxDays,
+		BatchWorkers:  batchWorkers,
+
+		AverageRounding: averageRounding,
+
+		CacheTTL:      l.duration("CACHE_TTL", defaultCacheTTL),
+		CacheStaleTTL: l.duration("CACHE_STALE_TTL", defaultCacheStaleTTL),
+		CacheMaxStale: l.duration("CACHE_MAX_STALE", defaultCacheMaxStale),
+
+		RateLimits: RateLimits{
+			PerMinute: l.int("RATE_LIMIT_PER_MINUTE", providers[provider].Limits.PerMinute, 0),
+			PerDay:    l.int("RATE_LIMIT_PER_DAY", providers[provider].Limits.PerDay, 0),
+		},
+		RateLimitMode:    parseSetting(l, "RATE_LIMIT_MODE", parseRateLimitMode),
+		RateLimitMaxWait: l.duration("RATE_LIMIT_MAX_WAIT", defaultRateLimitMaxWait),
+
+		RetryMaxAttempts: l.int("RETRY_MAX_ATTEMPTS", defaultRetryMaxAttempts, 1),
+		RetryBaseDelay:   l.duration("RETRY_BASE_DELAY", defaultRetryBaseDelay),
+		RetryMaxDelay:    l.duration("RETRY_MAX_DELAY", defaultRetryMaxDelay),
+
+		UpstreamTimeout: l.duration("UPSTREAM_TIMEOUT", defaultUpstreamTimeout),
+		RequestTimeout:  l.duration("REQUEST_TIMEOUT", defaultRequestTimeout),
+
+		ListenAddr:      l.lookup("LISTEN_ADDR"),
+		ReadTimeout:     l.duration("SERVER_READ_TIMEOUT", defaultReadTimeout),
+		WriteTimeout:    l.duration("SERVER_WRITE_TIMEOUT", defaultWriteTimeout),
+		IdleTimeout:     l.duration("SERVER_IDLE_TIMEOUT", defaultIdleTimeout),
+		ShutdownDelay:   l.duration("SHUTDOWN_DELAY", 0),
+		ShutdownTimeout: l.duration("SHUTDOWN_TIMEOUT", defaultShutdownTimeout),
+
+		LogLevel: parseSetting(l, "LOG_LEVEL", parseLogLevel),
+	}
+	if config.ListenAddr == "" {
+		config.ListenAddr = defaultListenAddr
+	}
 
-	log.Printf("Starting server on :8080 (SYMBOL=%s, NDAYS=%d)", config.Symbol, config.NDays)
-	if err := http.ListenAndServe(":8080", nil); err != nil {
-		log.Fatal(err)
+	if err := errors.Join(l.errs...); err != nil {
+		return nil, err
 	}
+	return config, nil
 }
 
 // createHandler creates the HTTP handler for the stock ticker endpoint
-func createHandler(config *Config, client HTTPClient) http.HandlerFunc {
+func createHandler(config *Config, provider Provider) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			writeMethodNotAllowed(w, r, http.MethodGet)
 			return
 		}
 
-		data, avgClose, err := fetchStockData(config.Symbol, config.NDays, config.APIKey, client)
+		query, err := parseStockQuery(r.URL.Query(), config)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Error fetching stock data: %v", err), http.StatusInternalServerError)
+			writeBadRequest(w, r, err)
 			return
 		}
 
-		response := StockResponse{
-			Symbol:       config.Symbol,
-			Days:         config.NDays,
-			AverageClose: avgClose,
-			Data:         data,
+		setRequestQuery(r.Context(), query.Symbol, query.Days)
+
+		ctx, cancel := requestContext(r, config.RequestTimeout)
+		defer cancel()
+
+		response, err := fetchStockData(ctx, provider, query)
+		if err != nil {
+			setRequestOutcome(r.Context(), upstreamOutcome(err), "")
+			writeUpstreamError(w, r, err)
+			return
 		}
+		setRequestOutcome(r.Context(), upstreamOutcome(nil), response.Cache.Status)
 
+		setCacheHeaders(w, response.Cache)
 		w.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(w).Encode(response); err != nil {
-			http.Error(w, fmt.Sprintf("Error encoding response: %v", err), http.StatusInternalServerError)
-			return
+			slog.ErrorContext(r.Context(), "Error encoding response", "error", err)
 		}
 	}
 }
 
-// fetchStockData gets stock data from the Alpha Vantage API
-func fetchStockData(symbol string, nDays int, apiKey string, client HTTPClient) ([]TimeSeriesData, float64, error) {
-	url := fmt.Sprintf("https://www.alphavantage.co/query?apikey=%s&function=TIME_SERIES_DAILY&symbol=%s", apiKey, symbol)
-
-	resp, err := client.Get(url)
-	if err != nil {
-		return nil, 0, err
+// requestContext returns the request's context, which is cancelled when the
+// client goes away, bounded by the overall request timeout when one is set
+func requestContext(r *http.Request, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(r.Context())
 	}
-	defer func() {
-		if cerr := resp.Body.Close(); cerr != nil {
-			err = fmt.Errorf("error closing response body: %v", cerr)
-		}
-	}()
+	return context.WithTimeout(r.Context(), timeout)
+}
 
-	var avResp AlphaVantageResponse
-	if err := json.NewDecoder(resp.Body).Decode(&avResp); err != nil {
-		return nil, 0, fmt.Errorf("error decoding response: %v", err)
+// fetchStockData gets the stock data described by query from the provider
+func fetchStockData(ctx context.Context, provider Provider, query stockQuery) (*StockResponse, error) {
+	symbol, nDays := query.Symbol, query.Days
+	// Returns need the days of history before the first returned day
+	fetchDays := nDays
+	if query.Returns != ReturnsNone {
+		fetchDays += query.VolatilityWindow
 	}
 
-	if avResp.TimeSeries == nil {
-		return nil, 0, fmt.Errorf("no time series data returned")
+	var bars []TimeSeriesData
+	var cache CacheInfo
+	var err error
+	if cached, ok := provider.(cacheInfoProvider); ok {
+		bars, cache, err = cached.CachedDailyBars(ctx, symbol, fetchDays)
+	} else {
+		bars, err = provider.DailyBars(ctx, symbol, fetchDays)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	data, avgClose := processTimeSeries(avResp.TimeSeries, nDays)
-	return data, avgClose, nil
-}
-
-// processTimeSeries processes the time series data from Alpha Vantage
-func processTimeSeries(timeSeries map[string]map[string]interface{}, nDays int) ([]TimeSeriesData, float64) {
 	var data []TimeSeriesData
-	var totalClose float64
-
-	var dates []string
-	for date := range timeSeries {
-		dates = append(dates, date)
+	var returns []ReturnPoint
+	var warnings []string
+	if query.Returns == ReturnsNone {
+		data, err = processTimeSeries(bars, nDays, query.Order)
+		warnings = droppedDays(bars, data, nDays)
+	} else {
+		data, returns, warnings, err = processReturns(bars, nDays, query.VolatilityWindow, query.Order)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	limit := nDays
-	if len(dates) < nDays {
-		limit = len(dates)
+	response := &StockResponse{
+		Symbol:        symbol,
+		Days:          nDays,
+		AvailableDays: len(data),
+		AverageClose:  averageClose(data, query.Rounding),
+		Stats:         computeStats(data, query.Stats, query.Rounding),
+		Data:          data,
+		Returns:       returns,
+		Warnings:      warnings,
+		Stale:         cache.Status == CacheStale,
+		AgeSeconds:    int64(cache.Age / time.Second),
+		Cache:         cache,
+	}
+	if query.Returns == ReturnsOnly {
+		response.Data = nil
 	}
+	return response, nil
+}
 
-	for i := 0; i < limit && i < len(dates); i++ {
-		date := dates[i]
-		dayData := timeSeries[date]
+// processTimeSeries selects the most recent nDays trading days from the
+// provider's bars and returns them in the requested order. Invalid bars are
+// skipped.
+func processTimeSeries(bars []TimeSeriesData, nDays int, order SortOrder) ([]TimeSeriesData, error) {
+	if nDays < 1 {
+		return nil, fmt.Errorf("invalid day count %d: must be at least 1", nDays)
+	}
 
-		closePriceStr, ok := dayData["4. close"].(string)
-		if !ok {
+	byDate := make(map[string]TimeSeriesData, len(bars))
+	keys := make([]string, 0, len(bars))
+	for _, bar := range bars {
+		if bar.Invalid {
 			continue
 		}
-		closePrice, err := strconv.ParseFloat(closePriceStr, 64)
-		if err != nil {
-			continue
+		if _, ok := byDate[bar.Date]; !ok {
+			keys = append(keys, bar.Date)
 		}
+		byDate[bar.Date] = bar
+	}
 
-		openPriceStr, _ := dayData["1. open"].(string)
-		openPrice, _ := strconv.ParseFloat(openPriceStr, 64)
-
-		highPriceStr, _ := dayData["2. high"].(string)
-		highPrice, _ := strconv.ParseFloat(highPriceStr, 64)
+	dates, err := selectTradingDays(keys, nDays, order)
+	if err != nil {
+		return nil, err
+	}
 
-		lowPriceStr, _ := dayData["3. low"].(string)
-		lowPrice, _ := strconv.ParseFloat(lowPriceStr, 64)
+	data := make([]TimeSeriesData, 0, len(dates))
+	for _, date := range dates {
+		data = append(data, byDate[date])
+	}
+	return data, nil
+}
 
-		volumeStr, _ := dayData["5. volume"].(string)
-		volume, _ := strconv.ParseInt(volumeStr, 10, 64)
+// averageClose returns the mean close price of data, rounded as r says
+func averageClose(data []TimeSeriesData, r Rounding) Price {
+	if len(data) == 0 {
+		return 0
+	}
 
-		data = append(data, TimeSeriesData{
-			Date:       date,
-			OpenPrice:  openPrice,
-			HighPrice:  highPrice,
-			LowPrice:   lowPrice,
-			ClosePrice: closePrice,
-			Volume:     volume,
-		})
+	var total Price
+	for _, bar := range data {
+		total += bar.ClosePrice
+	}
+	return total.Div(int64(len(data)), r)
+}
 
-		totalClose += closePrice
+// droppedDays describes the invalid bars that would have been in data, had
+// they been valid: those after its oldest day, or all of them when data
+// holds fewer than nDays
+func droppedDays(bars, data []TimeSeriesData, nDays int) []string {
+	var oldest string
+	if len(data) >= nDays {
+		oldest = data[0].Date
+		if last := data[len(data)-1].Date; last < oldest {
+			oldest = last
+		}
 	}
 
-	var avgClose float64
-	if len(data) > 0 {
-		avgClose = totalClose / float64(len(data))
+	var dropped []TimeSeriesData
+	for _, bar := range bars {
+		if bar.Invalid && bar.Date > oldest {
+			dropped = append(dropped, bar)
+		}
 	}
+	sort.Slice(dropped, func(i, j int) bool { return dropped[i].Date > dropped[j].Date })
 
-	return data, avgClose
+	var warnings []string
+	for _, bar := range dropped {
+		warnings = append(warnings, fmt.Sprintf("%s dropped: %s", bar.Date, strings.Join(bar.Warnings, "; ")))
+	}
+	return warnings
 }
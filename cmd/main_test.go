@@ -2,32 +2,128 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 // MockHTTPClient is a mock implementation of HTTPClient for testing
 type MockHTTPClient struct {
-	DoFunc func(url string) (*http.Response, error)
+	DoFunc func(ctx context.Context, url string) (*http.Response, error)
 }
 
 // Get is the mock implementation of HTTPClient.Get
-func (m *MockHTTPClient) Get(url string) (*http.Response, error) {
-	return m.DoFunc(url)
+func (m *MockHTTPClient) Get(ctx context.Context, url string) (*http.Response, error) {
+	return m.DoFunc(ctx, url)
+}
+
+// configEnvVars lists the environment variables read by loadConfig
+var configEnvVars = []string{
+	"CONFIG_FILE",
+	"SYMBOL",
+	"NDAYS",
+	"APIKEY",
+	"APIKEY_FILE",
+	"NDAYS_FILE",
+	"SECRET_REFRESH_INTERVAL",
+	"ORDER",
+	"PROVIDER",
+	"MAX_DAYS",
+	"BATCH_WORKERS",
+	"AVERAGE_ROUNDING",
+	"AVERAGE_DECIMALS",
+	"CACHE_TTL",
+	"CACHE_STALE_TTL",
+	"CACHE_MAX_STALE",
+	"RATE_LIMIT_PER_MINUTE",
+	"RATE_LIMIT_PER_DAY",
+	"RATE_LIMIT_MODE",
+	"RATE_LIMIT_MAX_WAIT",
+	"RETRY_MAX_ATTEMPTS",
+	"RETRY_BASE_DELAY",
+	"RETRY_MAX_DELAY",
+	"UPSTREAM_TIMEOUT",
+	"REQUEST_TIMEOUT",
+	"LISTEN_ADDR",
+	"SERVER_READ_TIMEOUT",
+	"SERVER_WRITE_TIMEOUT",
+	"SERVER_IDLE_TIMEOUT",
+	"SHUTDOWN_DELAY",
+	"SHUTDOWN_TIMEOUT",
+	"LOG_LEVEL",
+}
+
+// defaultTestConfig returns the Config loaded from SYMBOL=AAPL, NDAYS=5 and
+// APIKEY=test-api-key, with every other setting at its default
+func defaultTestConfig() *Config {
+	return &Config{
+		Symbol:       "AAPL",
+		NDays:        5,
+		APIKey:       "test-api-key",
+		Order:        OrderDescending,
+		Provider:     providerAlphaVantage,
+		MaxDays:      defaultMaxDays,
+		BatchWorkers: defaultBatchWorkers,
+
+		AverageRounding: Rounding{Mode: RoundHalfEven, Decimals: priceDecimals},
+
+		SecretRefresh: defaultSecretRefresh,
+
+		CacheTTL:      defaultCacheTTL,
+		CacheStaleTTL: defaultCacheStaleTTL,
+		CacheMaxStale: defaultCacheMaxStale,
+
+		RateLimits:       alphaVantageRateLimits,
+		RateLimitMode:    RateLimitQueue,
+		RateLimitMaxWait: defaultRateLimitMaxWait,
+
+		RetryMaxAttempts: defaultRetryMaxAttempts,
+		RetryBaseDelay:   defaultRetryBaseDelay,
+		RetryMaxDelay:    defaultRetryMaxDelay,
+		UpstreamTimeout:  defaultUpstreamTimeout,
+		RequestTimeout:   defaultRequestTimeout,
+		ListenAddr:       defaultListenAddr,
+		ReadTimeout:      defaultReadTimeout,
+		WriteTimeout:     defaultWriteTimeout,
+		IdleTimeout:      defaultIdleTimeout,
+		ShutdownTimeout:  defaultShutdownTimeout,
+	}
+}
+
+// expectedConfig returns defaultTestConfig with override applied, if any
+func expectedConfig(override func(c *Config)) *Config {
+	config := defaultTestConfig()
+	if override != nil {
+		override(config)
+	}
+	return config
 }
 
 func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "apikey")
+	if err := os.WriteFile(keyFile, []byte("file-api-key\n"), 0o400); err != nil {
+		t.Fatal(err)
+	}
+	nDaysFile := filepath.Join(dir, "ndays")
+	if err := os.WriteFile(nDaysFile, []byte(" 7 "), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
 	tests := []struct {
 		name        string
 		envVars     map[string]string
-		expected    *Config
+		override    func(c *Config)
 		expectError bool
 	}{
 		{
@@ -37,12 +133,6 @@ func TestLoadConfig(t *testing.T) {
 				"NDAYS":  "5",
 				"APIKEY": "test-api-key",
 			},
-			expected: &Config{
-				Symbol: "AAPL",
-				NDays:  5,
-				APIKey: "test-api-key",
-			},
-			expectError: false,
 		},
 		{
 			name: "Missing SYMBOL",
@@ -51,7 +141,6 @@ func TestLoadConfig(t *testing.T) {
 				"NDAYS":  "5",
 				"APIKEY": "test-api-key",
 			},
-			expected:    nil,
 			expectError: true,
 		},
 		{
@@ -61,7 +150,34 @@ func TestLoadConfig(t *testing.T) {
 				"NDAYS":  "",
 				"APIKEY": "test-api-key",
 			},
-			expected:    nil,
+			expectError: true,
+		},
+		{
+			name: "NDAYS zero",
+			envVars: map[string]string{
+				"SYMBOL": "AAPL",
+				"NDAYS":  "0",
+				"APIKEY": "test-api-key",
+			},
+			expectError: true,
+		},
+		{
+			name: "NDAYS negative",
+			envVars: map[string]string{
+				"SYMBOL": "AAPL",
+				"NDAYS":  "-5",
+				"APIKEY": "test-api-key",
+			},
+			expectError: true,
+		},
+		{
+			name: "NDAYS above MAX_DAYS",
+			envVars: map[string]string{
+				"SYMBOL":   "AAPL",
+				"NDAYS":    "250",
+				"APIKEY":   "test-api-key",
+				"MAX_DAYS": "200",
+			},
 			expectError: true,
 		},
 		{
@@ -71,7 +187,231 @@ func TestLoadConfig(t *testing.T) {
 				"NDAYS":  "invalid",
 				"APIKEY": "test-api-key",
 			},
-			expected:    nil,
+			expectError: true,
+		},
+		{
+			name: "Ascending ORDER",
+			envVars: map[string]string{
+				"SYMBOL": "AAPL",
+				"NDAYS":  "5",
+				"APIKEY": "test-api-key",
+				"ORDER":  "asc",
+			},
+			override: func(c *Config) {
+				c.Order = OrderAscending
+			},
+		},
+		{
+			name: "Custom average rounding",
+			envVars: map[string]string{
+				"SYMBOL":           "AAPL",
+				"NDAYS":            "5",
+				"APIKEY":           "test-api-key",
+				"AVERAGE_ROUNDING": "Half_Up",
+				"AVERAGE_DECIMALS": "2",
+			},
+			override: func(c *Config) {
+				c.AverageRounding = Rounding{Mode: RoundHalfUp, Decimals: 2}
+			},
+		},
+		{
+			name: "Invalid AVERAGE_DECIMALS",
+			envVars: map[string]string{
+				"SYMBOL":           "AAPL",
+				"NDAYS":            "5",
+				"APIKEY":           "test-api-key",
+				"AVERAGE_DECIMALS": "6",
+			},
+			expectError: true,
+		},
+		{
+			name: "Invalid AVERAGE_ROUNDING",
+			envVars: map[string]string{
+				"SYMBOL":           "AAPL",
+				"NDAYS":            "5",
+				"APIKEY":           "test-api-key",
+				"AVERAGE_ROUNDING": "ceiling",
+			},
+			expectError: true,
+		},
+		{
+			name: "Invalid ORDER",
+			envVars: map[string]string{
+				"SYMBOL": "AAPL",
+				"NDAYS":  "5",
+				"APIKEY": "test-api-key",
+				"ORDER":  "sideways",
+			},
+			expectError: true,
+		},
+		{
+			name: "Custom MAX_DAYS allows NDAYS beyond the compact output",
+			envVars: map[string]string{
+				"SYMBOL":   "msft",
+				"NDAYS":    "250",
+				"APIKEY":   "test-api-key",
+				"MAX_DAYS": "365",
+			},
+			override: func(c *Config) {
+				c.Symbol = "MSFT"
+				c.NDays = 250
+				c.MaxDays = 365
+			},
+		},
+		{
+			name: "Invalid MAX_DAYS",
+			envVars: map[string]string{
+				"SYMBOL":   "AAPL",
+				"NDAYS":    "5",
+				"APIKEY":   "test-api-key",
+				"MAX_DAYS": "0",
+			},
+			expectError: true,
+		},
+		{
+			name: "Invalid BATCH_WORKERS",
+			envVars: map[string]string{
+				"SYMBOL":        "AAPL",
+				"NDAYS":         "5",
+				"APIKEY":        "test-api-key",
+				"BATCH_WORKERS": "many",
+			},
+			expectError: true,
+		},
+		{
+			name: "Cache disabled",
+			envVars: map[string]string{
+				"SYMBOL":    "AAPL",
+				"NDAYS":     "5",
+				"APIKEY":    "test-api-key",
+				"CACHE_TTL": "0s",
+			},
+			override: func(c *Config) {
+				c.CacheTTL = 0
+			},
+		},
+		{
+			name: "Invalid CACHE_TTL",
+			envVars: map[string]string{
+				"SYMBOL":    "AAPL",
+				"NDAYS":     "5",
+				"APIKEY":    "test-api-key",
+				"CACHE_TTL": "five minutes",
+			},
+			expectError: true,
+		},
+		{
+			name: "Custom rate limits",
+			envVars: map[string]string{
+				"SYMBOL":                "AAPL",
+				"NDAYS":                 "5",
+				"APIKEY":                "test-api-key",
+				"RATE_LIMIT_PER_MINUTE": "75",
+				"RATE_LIMIT_PER_DAY":    "0",
+				"RATE_LIMIT_MODE":       "reject",
+			},
+			override: func(c *Config) {
+				c.RateLimits = RateLimits{PerMinute: 75, PerDay: 0}
+				c.RateLimitMode = RateLimitReject
+			},
+		},
+		{
+			name: "Invalid RATE_LIMIT_MODE",
+			envVars: map[string]string{
+				"SYMBOL":          "AAPL",
+				"NDAYS":           "5",
+				"APIKEY":          "test-api-key",
+				"RATE_LIMIT_MODE": "drop",
+			},
+			expectError: true,
+		},
+		{
+			name: "Custom server settings",
+			envVars: map[string]string{
+				"SYMBOL":           "AAPL",
+				"NDAYS":            "5",
+				"APIKEY":           "test-api-key",
+				"LISTEN_ADDR":      "127.0.0.1:9090",
+				"SHUTDOWN_DELAY":   "5s",
+				"SHUTDOWN_TIMEOUT": "25s",
+			},
+			override: func(c *Config) {
+				c.ListenAddr = "127.0.0.1:9090"
+				c.ShutdownDelay = 5 * time.Second
+				c.ShutdownTimeout = 25 * time.Second
+			},
+		},
+		{
+			name: "Invalid RETRY_MAX_ATTEMPTS",
+			envVars: map[string]string{
+				"SYMBOL":             "AAPL",
+				"NDAYS":              "5",
+				"APIKEY":             "test-api-key",
+				"RETRY_MAX_ATTEMPTS": "0",
+			},
+			expectError: true,
+		},
+		{
+			name: "Invalid REQUEST_TIMEOUT",
+			envVars: map[string]string{
+				"SYMBOL":          "AAPL",
+				"NDAYS":           "5",
+				"APIKEY":          "test-api-key",
+				"REQUEST_TIMEOUT": "soon",
+			},
+			expectError: true,
+		},
+		{
+			name: "Invalid LOG_LEVEL",
+			envVars: map[string]string{
+				"SYMBOL":    "AAPL",
+				"NDAYS":     "5",
+				"APIKEY":    "test-api-key",
+				"LOG_LEVEL": "verbose",
+			},
+			expectError: true,
+		},
+		{
+			name: "Settings read from files",
+			envVars: map[string]string{
+				"SYMBOL":                  "AAPL",
+				"NDAYS_FILE":              nDaysFile,
+				"APIKEY_FILE":             keyFile,
+				"SECRET_REFRESH_INTERVAL": "5m",
+			},
+			override: func(c *Config) {
+				c.NDays = 7
+				c.APIKey = "file-api-key"
+				c.APIKeyFile = keyFile
+				c.SecretRefresh = 5 * time.Minute
+			},
+		},
+		{
+			name: "APIKEY and APIKEY_FILE both set",
+			envVars: map[string]string{
+				"SYMBOL":      "AAPL",
+				"NDAYS":       "5",
+				"APIKEY":      "test-api-key",
+				"APIKEY_FILE": keyFile,
+			},
+			expectError: true,
+		},
+		{
+			name: "Missing APIKEY_FILE",
+			envVars: map[string]string{
+				"SYMBOL":      "AAPL",
+				"NDAYS":       "5",
+				"APIKEY_FILE": filepath.Join(dir, "missing"),
+			},
+			expectError: true,
+		},
+		{
+			name: "Invalid SYMBOL",
+			envVars: map[string]string{
+				"SYMBOL": "AAPL;rm",
+				"NDAYS":  "5",
+				"APIKEY": "test-api-key",
+			},
 			expectError: true,
 		},
 		{
@@ -81,7 +421,6 @@ func TestLoadConfig(t *testing.T) {
 				"NDAYS":  "5",
 				"APIKEY": "",
 			},
-			expected:    nil,
 			expectError: true,
 		},
 	}
@@ -89,15 +428,16 @@ func TestLoadConfig(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Save original environment variables
-			origSymbol := os.Getenv("SYMBOL")
-			origNDays := os.Getenv("NDAYS")
-			origAPIKey := os.Getenv("APIKEY")
+			orig := make(map[string]string, len(configEnvVars))
+			for _, name := range configEnvVars {
+				orig[name] = os.Getenv(name)
+			}
 
 			// Restore original environment variables after test
 			defer func() {
-				_ = os.Setenv("SYMBOL", origSymbol)
-				_ = os.Setenv("NDAYS", origNDays)
-				_ = os.Setenv("APIKEY", origAPIKey)
+				for name, value := range orig {
+					_ = os.Setenv(name, value)
+				}
 			}()
 
 			// Set test environment variables
@@ -105,7 +445,7 @@ func TestLoadConfig(t *testing.T) {
 				_ = os.Setenv(k, v)
 			}
 
-			config, err := loadConfig()
+			config, err := loadConfig("", nil)
 
 			// Check error
 			if tt.expectError && err == nil {
@@ -118,8 +458,8 @@ func TestLoadConfig(t *testing.T) {
 			if !tt.expectError {
 				if config == nil {
 					t.Error("Expected config, got nil")
-				} else if !reflect.DeepEqual(config, tt.expected) {
-					t.Errorf("Expected config %+v, got %+v", tt.expected, config)
+				} else if expected := expectedConfig(tt.override); !reflect.DeepEqual(config, expected) {
+					t.Errorf("Expected config %+v, got %+v", expected, config)
 				}
 			}
 		})
@@ -144,18 +484,18 @@ func TestCreateHandler(t *testing.T) {
 			name:   "GET request returns stock data",
 			method: http.MethodGet,
 			mockClient: &MockHTTPClient{
-				DoFunc: func(url string) (*http.Response, error) {
+				DoFunc: func(ctx context.Context, url string) (*http.Response, error) {
 					mockResponse := AlphaVantageResponse{
 						MetaData: map[string]interface{}{
 							"2. Symbol": "AAPL",
 						},
-						TimeSeries: map[string]map[string]interface{}{
+						TimeSeries: map[string]alphaVantageBar{
 							"2025-01-15": {
-								"1. open":   "234.50",
-								"2. high":   "236.80",
-								"3. low":    "233.20",
-								"4. close":  "235.60",
-								"5. volume": "45000000",
+								Open:   "234.50",
+								High:   "236.80",
+								Low:    "233.20",
+								Close:  "235.60",
+								Volume: "45000000",
 							},
 						},
 					}
@@ -194,7 +534,7 @@ func TestCreateHandler(t *testing.T) {
 			name:   "Error fetching stock data",
 			method: http.MethodGet,
 			mockClient: &MockHTTPClient{
-				DoFunc: func(url string) (*http.Response, error) {
+				DoFunc: func(ctx context.Context, url string) (*http.Response, error) {
 					return nil, fmt.Errorf("network error")
 				},
 			},
@@ -215,7 +555,8 @@ func TestCreateHandler(t *testing.T) {
 			recorder := httptest.NewRecorder()
 
 			// Create handler and serve request
-			handler := createHandler(config, tt.mockClient)
+			provider := &AlphaVantageProvider{APIKey: config.APIKey, Client: tt.mockClient}
+			handler := createHandler(config, provider)
 			handler.ServeHTTP(recorder, req)
 
 			// Check status code
@@ -238,7 +579,7 @@ func TestFetchStockData(t *testing.T) {
 		nDays          int
 		mockResponse   interface{}
 		statusCode     int
-		expectedAvg    float64
+		expectedAvg    Price
 		expectDataLen  int
 		expectedErrMsg string
 	}{
@@ -252,17 +593,17 @@ func TestFetchStockData(t *testing.T) {
 				MetaData: map[string]interface{}{
 					"2. Symbol": "AAPL",
 				},
-				TimeSeries: map[string]map[string]interface{}{
+				TimeSeries: map[string]alphaVantageBar{
 					"2025-01-15": {
-						"1. open":   "234.50",
-						"2. high":   "236.80",
-						"3. low":    "233.20",
-						"4. close":  "235.60",
-						"5. volume": "45000000",
+						Open:   "234.50",
+						High:   "236.80",
+						Low:    "233.20",
+						Close:  "235.60",
+						Volume: "45000000",
 					},
 				},
 			},
-			expectedAvg:    235.60,
+			expectedAvg:    testPrice("235.60"),
 			expectedErrMsg: "",
 		},
 		{
@@ -275,24 +616,24 @@ func TestFetchStockData(t *testing.T) {
 				MetaData: map[string]interface{}{
 					"2. Symbol": "AAPL",
 				},
-				TimeSeries: map[string]map[string]interface{}{
+				TimeSeries: map[string]alphaVantageBar{
 					"2025-01-15": {
-						"1. open":   "234.50",
-						"2. high":   "236.80",
-						"3. low":    "233.20",
-						"4. close":  "235.60",
-						"5. volume": "45000000",
+						Open:   "234.50",
+						High:   "236.80",
+						Low:    "233.20",
+						Close:  "235.60",
+						Volume: "45000000",
 					},
 					"2025-01-14": {
-						"1. open":   "232.50",
-						"2. high":   "234.80",
-						"3. low":    "231.20",
-						"4. close":  "233.60",
-						"5. volume": "43000000",
+						Open:   "232.50",
+						High:   "234.80",
+						Low:    "231.20",
+						Close:  "233.60",
+						Volume: "43000000",
 					},
 				},
 			},
-			expectedAvg:    234.60, // (235.60 + 233.60) / 2
+			expectedAvg:    testPrice("234.60"), // (235.60 + 233.60) / 2
 			expectedErrMsg: "",
 		},
 		{
@@ -305,17 +646,17 @@ func TestFetchStockData(t *testing.T) {
 				MetaData: map[string]interface{}{
 					"2. Symbol": "AAPL",
 				},
-				TimeSeries: map[string]map[string]interface{}{
+				TimeSeries: map[string]alphaVantageBar{
 					"2025-01-15": {
-						"1. open":   "234.50",
-						"2. high":   "236.80",
-						"3. low":    "233.20",
-						"4. close":  "235.60",
-						"5. volume": "45000000",
+						Open:   "234.50",
+						High:   "236.80",
+						Low:    "233.20",
+						Close:  "235.60",
+						Volume: "45000000",
 					},
 				},
 			},
-			expectedAvg:    235.60,
+			expectedAvg:    testPrice("235.60"),
 			expectedErrMsg: "",
 		},
 		{
@@ -361,13 +702,13 @@ func TestFetchStockData(t *testing.T) {
 				MetaData: map[string]interface{}{
 					"2. Symbol": "AAPL",
 				},
-				TimeSeries: map[string]map[string]interface{}{
+				TimeSeries: map[string]alphaVantageBar{
 					"2025-01-15": {
-						"1. open":   "234.50",
-						"2. high":   "236.80",
-						"3. low":    "233.20",
-						"4. close":  "invalid",
-						"5. volume": "45000000",
+						Open:   "234.50",
+						High:   "236.80",
+						Low:    "233.20",
+						Close:  "invalid",
+						Volume: "45000000",
 					},
 				},
 			},
@@ -380,7 +721,7 @@ func TestFetchStockData(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			// Create mock client
 			client := &MockHTTPClient{
-				DoFunc: func(url string) (*http.Response, error) {
+				DoFunc: func(ctx context.Context, url string) (*http.Response, error) {
 					if tt.statusCode == http.StatusInternalServerError {
 						return nil, fmt.Errorf("mock HTTP error")
 					}
@@ -400,7 +741,8 @@ func TestFetchStockData(t *testing.T) {
 			}
 
 			// Call function under test
-			data, avgClose, err := fetchStockData(tt.symbol, tt.nDays, "dummy-api-key", client)
+			provider := &AlphaVantageProvider{APIKey: "dummy-api-key", Client: client}
+			resp, err := fetchStockData(context.Background(), provider, stockQuery{Symbol: tt.symbol, Days: tt.nDays, Order: OrderDescending})
 
 			// Check error
 			if tt.expectedErrMsg != "" {
@@ -420,13 +762,12 @@ func TestFetchStockData(t *testing.T) {
 				}
 
 				// Check data length
-				if len(data) != tt.expectDataLen {
-					t.Errorf("Expected %d data points, got %d", tt.expectDataLen, len(data))
+				if len(resp.Data) != tt.expectDataLen {
+					t.Errorf("Expected %d data points, got %d", tt.expectDataLen, len(resp.Data))
 				}
 
-				// Check average with a small tolerance for floating point rounding
-				if tt.expectedAvg != 0 && (avgClose < tt.expectedAvg-0.001 || avgClose > tt.expectedAvg+0.001) {
-					t.Errorf("Expected average close %f, got %f", tt.expectedAvg, avgClose)
+				if resp.AverageClose != tt.expectedAvg {
+					t.Errorf("Expected average close %v, got %v", tt.expectedAvg, resp.AverageClose)
 				}
 			}
 		})
@@ -436,82 +777,54 @@ func TestFetchStockData(t *testing.T) {
 func TestProcessTimeSeries(t *testing.T) {
 	tests := []struct {
 		name        string
-		timeSeries  map[string]map[string]interface{}
+		bars        []TimeSeriesData
 		nDays       int
 		expectedLen int
-		expectedAvg float64
+		expectedAvg Price
 	}{
 		{
 			name: "Single day",
-			timeSeries: map[string]map[string]interface{}{
-				"2025-01-15": {
-					"1. open":   "234.50",
-					"2. high":   "236.80",
-					"3. low":    "233.20",
-					"4. close":  "235.60",
-					"5. volume": "45000000",
-				},
+			bars: []TimeSeriesData{
+				{Date: "2025-01-15", OpenPrice: testPrice("234.50"), HighPrice: testPrice("236.80"), LowPrice: testPrice("233.20"), ClosePrice: testPrice("235.60"), Volume: 45000000},
 			},
 			nDays:       1,
 			expectedLen: 1,
-			expectedAvg: 235.60,
+			expectedAvg: testPrice("235.60"),
 		},
 		{
 			name: "Multiple days",
-			timeSeries: map[string]map[string]interface{}{
-				"2025-01-15": {
-					"1. open":   "234.50",
-					"2. high":   "236.80",
-					"3. low":    "233.20",
-					"4. close":  "235.60",
-					"5. volume": "45000000",
-				},
-				"2025-01-14": {
-					"1. open":   "232.50",
-					"2. high":   "234.80",
-					"3. low":    "231.20",
-					"4. close":  "233.60",
-					"5. volume": "43000000",
-				},
+			bars: []TimeSeriesData{
+				{Date: "2025-01-15", OpenPrice: testPrice("234.50"), HighPrice: testPrice("236.80"), LowPrice: testPrice("233.20"), ClosePrice: testPrice("235.60"), Volume: 45000000},
+				{Date: "2025-01-14", OpenPrice: testPrice("232.50"), HighPrice: testPrice("234.80"), LowPrice: testPrice("231.20"), ClosePrice: testPrice("233.60"), Volume: 43000000},
 			},
 			nDays:       2,
 			expectedLen: 2,
-			expectedAvg: 234.60,
+			expectedAvg: testPrice("234.60"),
 		},
 		{
 			name: "More days requested than available",
-			timeSeries: map[string]map[string]interface{}{
-				"2025-01-15": {
-					"1. open":   "234.50",
-					"2. high":   "236.80",
-					"3. low":    "233.20",
-					"4. close":  "235.60",
-					"5. volume": "45000000",
-				},
+			bars: []TimeSeriesData{
+				{Date: "2025-01-15", OpenPrice: testPrice("234.50"), HighPrice: testPrice("236.80"), LowPrice: testPrice("233.20"), ClosePrice: testPrice("235.60"), Volume: 45000000},
 			},
 			nDays:       5,
 			expectedLen: 1,
-			expectedAvg: 235.60,
+			expectedAvg: testPrice("235.60"),
 		},
 		{
-			name:        "Empty time series",
-			timeSeries:  map[string]map[string]interface{}{},
-			nDays:       5,
-			expectedLen: 0,
-			expectedAvg: 0,
+			name: "Fewer days requested than available",
+			bars: []TimeSeriesData{
+				{Date: "2025-01-14", ClosePrice: testPrice("233.60")},
+				{Date: "2025-01-15", ClosePrice: testPrice("235.60")},
+				{Date: "2025-01-13", ClosePrice: testPrice("231.60")},
+			},
+			nDays:       2,
+			expectedLen: 2,
+			expectedAvg: testPrice("234.60"),
 		},
 		{
-			name: "Invalid close price",
-			timeSeries: map[string]map[string]interface{}{
-				"2025-01-15": {
-					"1. open":   "234.50",
-					"2. high":   "236.80",
-					"3. low":    "233.20",
-					"4. close":  "invalid",
-					"5. volume": "45000000",
-				},
-			},
-			nDays:       1,
+			name:        "Empty time series",
+			bars:        []TimeSeriesData{},
+			nDays:       5,
 			expectedLen: 0,
 			expectedAvg: 0,
 		},
@@ -520,33 +833,45 @@ func TestProcessTimeSeries(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Call function under test
-			data, avgClose := processTimeSeries(tt.timeSeries, tt.nDays)
+			data, err := processTimeSeries(tt.bars, tt.nDays, OrderDescending)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
 
 			// Check data length
 			if len(data) != tt.expectedLen {
 				t.Errorf("Expected %d data points, got %d", tt.expectedLen, len(data))
 			}
 
-			// Check average with a small tolerance for floating point rounding
-			if tt.expectedAvg != 0 && (avgClose < tt.expectedAvg-0.001 || avgClose > tt.expectedAvg+0.001) {
-				t.Errorf("Expected average close %f, got %f", tt.expectedAvg, avgClose)
+			if avgClose := averageClose(data, Rounding{}); avgClose != tt.expectedAvg {
+				t.Errorf("Expected average close %v, got %v", tt.expectedAvg, avgClose)
 			}
 		})
 	}
 }
 
+func TestProcessTimeSeriesRejectsInvalidDays(t *testing.T) {
+	bars := []TimeSeriesData{{Date: "2025-01-15", ClosePrice: testPrice("235.60")}}
+	for _, nDays := range []int{0, -1} {
+		if _, err := processTimeSeries(bars, nDays, OrderDescending); err == nil {
+			t.Errorf("Expected error for %d days, got nil", nDays)
+		}
+	}
+}
+
 func TestResponseEncoding(t *testing.T) {
 	resp := StockResponse{
-		Symbol:       "AAPL",
-		Days:         5,
-		AverageClose: 235.60,
+		Symbol:        "AAPL",
+		Days:          5,
+		AvailableDays: 1,
+		AverageClose:  testPrice("235.60"),
 		Data: []TimeSeriesData{
 			{
 				Date:       "2025-01-15",
-				OpenPrice:  234.50,
-				HighPrice:  236.80,
-				LowPrice:   233.20,
-				ClosePrice: 235.60,
+				OpenPrice:  testPrice("234.50"),
+				HighPrice:  testPrice("236.80"),
+				LowPrice:   testPrice("233.20"),
+				ClosePrice: testPrice("235.60"),
 				Volume:     45000000,
 			},
 		},
@@ -564,6 +889,7 @@ func TestResponseEncoding(t *testing.T) {
 	expectedFields := []string{
 		`"symbol":"AAPL"`,
 		`"days":5`,
+		`"available_days":1`,
 		`"average_close":235.6`,
 		`"data":[`,
 		`"date":"2025-01-15"`,
@@ -596,7 +922,7 @@ func TestResponseEncoding(t *testing.T) {
 	}
 
 	if decoded.AverageClose != resp.AverageClose {
-		t.Errorf("Expected AverageClose %f, got %f", resp.AverageClose, decoded.AverageClose)
+		t.Errorf("Expected AverageClose %v, got %v", resp.AverageClose, decoded.AverageClose)
 	}
 
 	if len(decoded.Data) != len(resp.Data) {
@@ -607,7 +933,29 @@ func TestResponseEncoding(t *testing.T) {
 		}
 
 		if decoded.Data[0].ClosePrice != resp.Data[0].ClosePrice {
-			t.Errorf("Expected ClosePrice %f, got %f", resp.Data[0].ClosePrice, decoded.Data[0].ClosePrice)
+			t.Errorf("Expected ClosePrice %v, got %v", resp.Data[0].ClosePrice, decoded.Data[0].ClosePrice)
+		}
+	}
+}
+
+func TestDefaultHTTPClientTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
 		}
+	}))
+	defer server.Close()
+
+	client := &DefaultHTTPClient{Timeout: 20 * time.Millisecond}
+	if _, err := client.Get(context.Background(), server.URL); !isTimeout(err) {
+		t.Errorf("Expected a timeout error, got %v", err)
+	}
+
+	client = &DefaultHTTPClient{}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := client.Get(ctx, server.URL); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
 	}
 }
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metricsContentType is the Prometheus text exposition format
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// defaultLatencyBuckets are the histogram bucket upper bounds in seconds.
+// They run past the default REQUEST_TIMEOUT of 30s, so requests that time
+// out and upstream calls slowed by retries and rate limit waits are still
+// resolved below +Inf.
+var defaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// Metrics holds the service's Prometheus metrics. A nil *Metrics records
+// nothing, so instrumented code does not need to check for it.
+type Metrics struct {
+	requests         *metricVec
+	requestDuration  *metricVec
+	upstreamCalls    *metricVec
+	upstreamDuration *metricVec
+	cacheLookups     *metricVec
+}
+
+// NewMetrics returns an empty set of metrics
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requests: newCounterVec("stock_ticker_http_requests_total",
+			"HTTP requests served, by route, method and status code.",
+			"route", "method", "status"),
+		requestDuration: newHistogramVec("stock_ticker_http_request_duration_seconds",
+			"Time taken to serve HTTP requests, by route and status code.",
+			defaultLatencyBuckets, "route", "status"),
+		upstreamCalls: newCounterVec("stock_ticker_upstream_requests_total",
+			"Calls to the market data provider, by provider and outcome.",
+			"provider", "outcome"),
+		upstreamDuration: newHistogramVec("stock_ticker_upstream_request_duration_seconds",
+			"Time taken by calls to the market data provider, including retries, by provider and outcome.",
+			defaultLatencyBuckets, "provider", "outcome"),
+		cacheLookups: newCounterVec("stock_ticker_cache_requests_total",
+			"Cache lookups, by how they were served (hit, miss or stale).",
+			"status"),
+	}
+}
+
+// ObserveRequest records a served HTTP request
+func (m *Metrics) ObserveRequest(route, method string, status int, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	code := strconv.Itoa(status)
+	m.requests.inc(route, metricMethod(method), code)
+	m.requestDuration.observe(elapsed.Seconds(), route, code)
+}
+
+// ObserveUpstream records a call to the market data provider
+func (m *Metrics) ObserveUpstream(provider string, err error, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	outcome := upstreamOutcome(err)
+	m.upstreamCalls.inc(provider, outcome)
+	m.upstreamDuration.observe(elapsed.Seconds(), provider, outcome)
+}
+
+// ObserveCache records how the cache served a lookup
+func (m *Metrics) ObserveCache(status CacheStatus) {
+	if m == nil {
+		return
+	}
+	m.cacheLookups.inc(strings.ToLower(string(status)))
+}
+
+// upstreamOutcome names the outcome of an upstream call using the same
+// codes as the error responses
+func upstreamOutcome(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	if errors.Is(err, context.Canceled) {
+		return "canceled"
+	}
+	_, detail := upstreamError(err)
+	return detail.Code
+}
+
+// metricMethod bounds the method label to the standard methods
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	default:
+		return "OTHER"
+	}
+}
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader implements the http.ResponseWriter interface
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Write implements the http.ResponseWriter interface
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// instrumentHandler assigns every request served by mux a request ID, then
+// records metrics and writes an access log line once it is served. The
+// route is the mux pattern that matched, which keeps label values bounded.
+func instrumentHandler(metrics *Metrics, mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := requestID(r)
+		info := &requestInfo{}
+		ctx := context.WithValue(r.Context(), requestIDKey, id)
+		ctx = context.WithValue(ctx, requestInfoKey, info)
+		r = r.WithContext(ctx)
+		w.Header().Set(requestIDHeader, id)
+
+		recorder := &statusRecorder{ResponseWriter: w}
+		mux.ServeHTTP(recorder, r)
+
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		elapsed := time.Since(start)
+		metrics.ObserveRequest(route, r.Method, status, elapsed)
+		logRequest(r, route, status, elapsed, info)
+	})
+}
+
+// createMetricsHandler creates the HTTP handler for the Prometheus metrics
+// endpoint. The remaining provider quota is read from limiter on each scrape.
+func createMetricsHandler(metrics *Metrics, limiter *RateLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, r, http.MethodGet)
+			return
+		}
+
+		w.Header().Set("Content-Type", metricsContentType)
+		out := bufio.NewWriter(w)
+		for _, vec := range []*metricVec{metrics.requests, metrics.requestDuration, metrics.upstreamCalls, metrics.upstreamDuration, metrics.cacheLookups} {
+			vec.write(out)
+		}
+		writeQuotaMetrics(out, limiter.Status())
+		if err := out.Flush(); err != nil {
+			slog.ErrorContext(r.Context(), "Error writing metrics", "error", err)
+		}
+	}
+}
+
+// writeQuotaMetrics writes the provider quota gauges
+func writeQuotaMetrics(w io.Writer, windows []RateLimitStatus) {
+	fmt.Fprintf(w, "# HELP stock_ticker_rate_limit_remaining Calls left in the outbound budget, by window.\n")
+	fmt.Fprintf(w, "# TYPE stock_ticker_rate_limit_remaining gauge\n")
+	for _, window := range windows {
+		fmt.Fprintf(w, "stock_ticker_rate_limit_remaining%s %d\n", formatLabels([]string{"window"}, []string{window.Window}), window.Remaining)
+	}
+	fmt.Fprintf(w, "# HELP stock_ticker_rate_limit_limit Size of the outbound budget, by window.\n")
+	fmt.Fprintf(w, "# TYPE stock_ticker_rate_limit_limit gauge\n")
+	for _, window := range windows {
+		fmt.Fprintf(w, "stock_ticker_rate_limit_limit%s %d\n", formatLabels([]string{"window"}, []string{window.Window}), window.Limit)
+	}
+}
+
+// metricVec is a counter or histogram partitioned by label values
+type metricVec struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*metricSeries
+}
+
+// metricSeries is one labelled counter or histogram
+type metricSeries struct {
+	values []string
+	// count is the counter value, or the number of histogram observations
+	count float64
+	sum   float64
+	// buckets counts the observations at or below each bucket bound
+	buckets []uint64
+}
+
+// newCounterVec returns a counter partitioned by labels
+func newCounterVec(name, help string, labels ...string) *metricVec {
+	return &metricVec{name: name, help: help, kind: "counter", labels: labels, series: make(map[string]*metricSeries)}
+}
+
+// newHistogramVec returns a histogram with the given bucket bounds
+// partitioned by labels
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *metricVec {
+	return &metricVec{name: name, help: help, kind: "histogram", labels: labels, buckets: buckets, series: make(map[string]*metricSeries)}
+}
+
+// seriesLocked returns the series for values, creating it if needed.
+// v.mu must be held.
+func (v *metricVec) seriesLocked(values []string) *metricSeries {
+	key := strings.Join(values, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &metricSeries{values: values, buckets: make([]uint64, len(v.buckets))}
+		v.series[key] = s
+	}
+	return s
+}
+
+// inc adds one to the counter for values
+func (v *metricVec) inc(values ...string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.seriesLocked(values).count++
+}
+
+// observe adds value to the histogram for values
+func (v *metricVec) observe(value float64, values ...string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	s := v.seriesLocked(values)
+	s.count++
+	s.sum += value
+	for i, bound := range v.buckets {
+		if value <= bound {
+			s.buckets[i]++
+		}
+	}
+}
+
+// write writes the metric in the Prometheus text format, with series in
+// label order so the output is stable
+func (v *metricVec) write(w io.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, v.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, v.kind)
+
+	bucketLabels := append(append([]string{}, v.labels...), "le")
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := v.series[key]
+		if v.kind == "counter" {
+			fmt.Fprintf(w, "%s%s %s\n", v.name, formatLabels(v.labels, s.values), formatValue(s.count))
+			continue
+		}
+
+		bucketValues := append(append([]string{}, s.values...), "")
+		for i, bound := range v.buckets {
+			bucketValues[len(bucketValues)-1] = formatValue(bound)
+			fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, formatLabels(bucketLabels, bucketValues), s.buckets[i])
+		}
+		bucketValues[len(bucketValues)-1] = "+Inf"
+		fmt.Fprintf(w, "%s_bucket%s %s\n", v.name, formatLabels(bucketLabels, bucketValues), formatValue(s.count))
+		fmt.Fprintf(w, "%s_sum%s %s\n", v.name, formatLabels(v.labels, s.values), formatValue(s.sum))
+		fmt.Fprintf(w, "%s_count%s %s\n", v.name, formatLabels(v.labels, s.values), formatValue(s.count))
+	}
+}
+
+// labelEscaper escapes label values for the text format
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatLabels renders a label set such as {route="/",status="200"}
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(values[i]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// formatValue renders a sample value
+func formatValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scrapeMetrics returns the /metrics output for metrics and limiter
+func scrapeMetrics(t *testing.T, metrics *Metrics, limiter *RateLimiter) string {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	createMetricsHandler(metrics, limiter).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, recorder.Code)
+	}
+	if ct := recorder.Header().Get("Content-Type"); ct != metricsContentType {
+		t.Errorf("Expected content type %q, got %q", metricsContentType, ct)
+	}
+	return recorder.Body.String()
+}
+
+// expectLines fails the test for each line missing from output
+func expectLines(t *testing.T, output string, lines ...string) {
+	t.Helper()
+
+	present := make(map[string]bool)
+	for _, line := range strings.Split(output, "\n") {
+		present[line] = true
+	}
+	for _, line := range lines {
+		if !present[line] {
+			t.Errorf("Expected line %q in output:\n%s", line, output)
+		}
+	}
+}
+
+func TestMetricsExposition(t *testing.T) {
+	metrics := NewMetrics()
+	metrics.ObserveRequest("/{$}", http.MethodGet, http.StatusOK, 30*time.Millisecond)
+	metrics.ObserveRequest("/{$}", http.MethodGet, http.StatusOK, 2*time.Second)
+	metrics.ObserveRequest("/{$}", "BREW", http.StatusMethodNotAllowed, time.Millisecond)
+	metrics.ObserveRequest("/{$}", http.MethodGet, http.StatusGatewayTimeout, 30*time.Second+5*time.Millisecond)
+	metrics.ObserveUpstream(providerAlphaVantage, nil, 200*time.Millisecond)
+	metrics.ObserveUpstream(providerAlphaVantage, fmt.Errorf("%w: call frequency", ErrRateLimited), 100*time.Millisecond)
+	metrics.ObserveUpstream(providerAlphaVantage, context.Canceled, time.Millisecond)
+	metrics.ObserveCache(CacheHit)
+	metrics.ObserveCache(CacheHit)
+	metrics.ObserveCache(CacheMiss)
+
+	clock := &fakeClock{now: time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)}
+	limiter := newTestLimiter(alphaVantageRateLimits, RateLimitQueue, time.Second, clock)
+	if err := limiter.Wait(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	output := scrapeMetrics(t, metrics, limiter)
+	expectLines(t, output,
+		"# TYPE stock_ticker_http_requests_total counter",
+		`stock_ticker_http_requests_total{route="/{$}",method="GET",status="200"} 2`,
+		`stock_ticker_http_requests_total{route="/{$}",method="OTHER",status="405"} 1`,
+		"# TYPE stock_ticker_http_request_duration_seconds histogram",
+		`stock_ticker_http_request_duration_seconds_bucket{route="/{$}",status="200",le="0.025"} 0`,
+		`stock_ticker_http_request_duration_seconds_bucket{route="/{$}",status="200",le="0.05"} 1`,
+		`stock_ticker_http_request_duration_seconds_bucket{route="/{$}",status="200",le="2.5"} 2`,
+		`stock_ticker_http_request_duration_seconds_bucket{route="/{$}",status="200",le="+Inf"} 2`,
+		`stock_ticker_http_request_duration_seconds_sum{route="/{$}",status="200"} 2.03`,
+		`stock_ticker_http_request_duration_seconds_count{route="/{$}",status="200"} 2`,
+		`stock_ticker_http_request_duration_seconds_bucket{route="/{$}",status="504",le="30"} 0`,
+		`stock_ticker_http_request_duration_seconds_bucket{route="/{$}",status="504",le="60"} 1`,
+		`stock_ticker_upstream_requests_total{provider="alphavantage",outcome="ok"} 1`,
+		`stock_ticker_upstream_requests_total{provider="alphavantage",outcome="rate_limited"} 1`,
+		`stock_ticker_upstream_requests_total{provider="alphavantage",outcome="canceled"} 1`,
+		`stock_ticker_upstream_request_duration_seconds_count{provider="alphavantage",outcome="ok"} 1`,
+		`stock_ticker_cache_requests_total{status="hit"} 2`,
+		`stock_ticker_cache_requests_total{status="miss"} 1`,
+		"# TYPE stock_ticker_rate_limit_remaining gauge",
+		`stock_ticker_rate_limit_remaining{window="minute"} 4`,
+		`stock_ticker_rate_limit_remaining{window="day"} 24`,
+		`stock_ticker_rate_limit_limit{window="day"} 25`,
+	)
+}
+
+func TestInstrumentHandler(t *testing.T) {
+	metrics := NewMetrics()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/{$}", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	})
+	mux.HandleFunc("/", writeNotFound)
+	handler := instrumentHandler(metrics, mux)
+
+	for _, path := range []string{"/", "/unknown/path", "/another"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	limiter := NewRateLimiter(RateLimits{}, RateLimitQueue, 0)
+	expectLines(t, scrapeMetrics(t, metrics, limiter),
+		`stock_ticker_http_requests_total{route="/{$}",method="GET",status="200"} 1`,
+		`stock_ticker_http_requests_total{route="/",method="GET",status="404"} 2`,
+	)
+}
+
+func TestCachingProviderMetrics(t *testing.T) {
+	var calls int32
+	clock := &fakeClock{now: time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)}
+	cache := newTestCache(countingProvider(&calls, 0), clock)
+	cache.Metrics = NewMetrics()
+
+	for i := 0; i < 3; i++ {
+		if _, _, err := cache.CachedDailyBars(context.Background(), "AAPL", 5); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	limiter := NewRateLimiter(RateLimits{}, RateLimitQueue, 0)
+	expectLines(t, scrapeMetrics(t, cache.Metrics, limiter),
+		`stock_ticker_cache_requests_total{status="hit"} 2`,
+		`stock_ticker_cache_requests_total{status="miss"} 1`,
+	)
+}
+
+func TestFormatLabels(t *testing.T) {
+	got := formatLabels([]string{"a", "b"}, []string{`say "hi"`, "back\\slash\nnewline"})
+	expected := `{a="say \"hi\"",b="back\\slash\nnewline"}`
+	if got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Price is an exact decimal amount, counted in ten-thousandths so that the
+// four decimal places vendors quote survive parsing, arithmetic and JSON
+// encoding unchanged
+type Price int64
+
+const (
+	// priceDecimals is the number of decimal places a Price holds
+	priceDecimals = 4
+	// priceScale is the number of Price units in 1
+	priceScale = 10000
+)
+
+// parsePrice parses a decimal string such as "234.5000". Values with more
+// decimal places than a Price holds are rejected rather than rounded.
+func parsePrice(s string) (Price, error) {
+	text := s
+	negative := strings.HasPrefix(text, "-")
+	if negative || strings.HasPrefix(text, "+") {
+		text = text[1:]
+	}
+
+	whole, frac, _ := strings.Cut(text, ".")
+	if whole == "" && frac == "" || !isDigits(whole) || !isDigits(frac) {
+		return 0, fmt.Errorf("%q is not a decimal number", s)
+	}
+	frac = strings.TrimRight(frac, "0")
+	if len(frac) > priceDecimals {
+		return 0, fmt.Errorf("%q has more than %d decimal places", s, priceDecimals)
+	}
+	frac += strings.Repeat("0", priceDecimals-len(frac))
+
+	units, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is out of range", s)
+	}
+	if negative {
+		units = -units
+	}
+	return Price(units), nil
+}
+
+// isDigits reports whether s holds only ASCII digits
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// String formats the price with as many decimal places as it needs
+func (p Price) String() string {
+	return p.Text(0)
+}
+
+// Text formats the price with at least minDecimals decimal places, and more
+// when they are needed to show it exactly
+func (p Price) Text(minDecimals int) string {
+	units := int64(p)
+	sign := ""
+	if units < 0 {
+		sign, units = "-", -units
+	}
+
+	frac := strings.TrimRight(fmt.Sprintf("%0*d", priceDecimals, units%priceScale), "0")
+	if len(frac) < minDecimals {
+		frac += strings.Repeat("0", minDecimals-len(frac))
+	}
+	text := sign + strconv.FormatInt(units/priceScale, 10)
+	if frac != "" {
+		text += "." + frac
+	}
+	return text
+}
+
+// MarshalJSON encodes the price as an exact JSON number
+func (p Price) MarshalJSON() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalJSON decodes a JSON number or string holding a decimal
+func (p *Price) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if text == "null" {
+		return nil
+	}
+	if strings.HasPrefix(text, `"`) {
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+	}
+
+	price, err := parsePrice(text)
+	if err != nil {
+		return err
+	}
+	*p = price
+	return nil
+}
+
+// RoundingMode says which way a value between two decimal places is rounded
+type RoundingMode string
+
+const (
+	// RoundHalfEven rounds to the nearest value, and ties to an even last digit
+	RoundHalfEven RoundingMode = "half_even"
+	// RoundHalfUp rounds to the nearest value, and ties away from zero
+	RoundHalfUp RoundingMode = "half_up"
+	// RoundDown truncates toward zero
+	RoundDown RoundingMode = "down"
+)
+
+// parseRoundingMode parses a rounding mode, defaulting to half-even when empty
+func parseRoundingMode(s string) (RoundingMode, error) {
+	switch mode := RoundingMode(strings.ToLower(strings.TrimSpace(s))); mode {
+	case "":
+		return RoundHalfEven, nil
+	case RoundHalfEven, RoundHalfUp, RoundDown:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid rounding mode %q: must be %q, %q or %q", s, RoundHalfEven, RoundHalfUp, RoundDown)
+	}
+}
+
+// parseDecimals parses a number of decimal places to round to, defaulting
+// to every place a Price holds when empty
+func parseDecimals(s string) (int, error) {
+	if strings.TrimSpace(s) == "" {
+		return priceDecimals, nil
+	}
+	decimals, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || decimals < 0 || decimals > priceDecimals {
+		return 0, fmt.Errorf("must be a number between 0 and %d, got %q", priceDecimals, s)
+	}
+	return decimals, nil
+}
+
+// Rounding says how a computed price, such as an average, is rounded. The
+// zero Rounding keeps every decimal place, rounding half-even.
+type Rounding struct {
+	Mode     RoundingMode
+	Decimals int
+}
+
+// priceFromFloat converts a computed value, such as a standard deviation,
+// to a Price rounded as r says
+func priceFromFloat(f float64, r Rounding) Price {
+	return Price(math.Round(f*priceScale)).Div(1, r)
+}
+
+// Div returns p divided by n, rounded as r says
+func (p Price) Div(n int64, r Rounding) Price {
+	return divRound(big.NewInt(int64(p)), big.NewInt(n), r)
+}
+
+// divRound returns num/den Price units, rounded as r says. It works on big
+// integers so that sums of price times volume cannot overflow.
+func divRound(num, den *big.Int, r Rounding) Price {
+	decimals := r.Decimals
+	if r == (Rounding{}) {
+		decimals = priceDecimals
+	}
+	unit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(priceDecimals-decimals)), nil)
+
+	divisor := new(big.Int).Mul(den, unit)
+	negative := num.Sign()*divisor.Sign() < 0
+	divisor.Abs(divisor)
+	quotient, remainder := new(big.Int).QuoRem(new(big.Int).Abs(num), divisor, new(big.Int))
+
+	var away bool
+	switch half := remainder.Lsh(remainder, 1).Cmp(divisor); r.Mode {
+	case RoundDown:
+	case RoundHalfUp:
+		away = half >= 0
+	default:
+		away = half > 0 || half == 0 && quotient.Bit(0) == 1
+	}
+	if away {
+		quotient.Add(quotient, big.NewInt(1))
+	}
+	if negative {
+		quotient.Neg(quotient)
+	}
+	return Price(quotient.Mul(quotient, unit).Int64())
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// testPrice parses a price literal, panicking if it is malformed
+func testPrice(s string) Price {
+	price, err := parsePrice(s)
+	if err != nil {
+		panic(err)
+	}
+	return price
+}
+
+func TestParsePrice(t *testing.T) {
+	tests := []struct {
+		input       string
+		expected    Price
+		expectError bool
+	}{
+		{input: "234.5000", expected: 2345000},
+		{input: "236.6", expected: 2366000},
+		{input: "0.0001", expected: 1},
+		{input: "12", expected: 120000},
+		{input: ".5", expected: 5000},
+		{input: "-1.25", expected: -12500},
+		{input: "+3.10000", expected: 31000},
+		{input: "1.23456", expectError: true},
+		{input: "1e3", expectError: true},
+		{input: "12.3.4", expectError: true},
+		{input: "NaN", expectError: true},
+		{input: ".", expectError: true},
+		{input: "", expectError: true},
+		{input: "99999999999999999", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			price, err := parsePrice(tt.input)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error, got %d", price)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if price != tt.expected {
+				t.Errorf("Expected %d, got %d", tt.expected, price)
+			}
+		})
+	}
+}
+
+func TestPriceText(t *testing.T) {
+	tests := []struct {
+		price       Price
+		minDecimals int
+		expected    string
+	}{
+		{testPrice("236.6"), 0, "236.6"},
+		{testPrice("236.6"), 2, "236.60"},
+		{testPrice("100"), 0, "100"},
+		{testPrice("100"), 2, "100.00"},
+		{testPrice("0.0001"), 2, "0.0001"},
+		{testPrice("-0.5"), 0, "-0.5"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.price.Text(tt.minDecimals); got != tt.expected {
+			t.Errorf("Text(%d) of %d: expected %q, got %q", tt.minDecimals, tt.price, tt.expected, got)
+		}
+	}
+}
+
+func TestPriceJSON(t *testing.T) {
+	bar := TimeSeriesData{Date: "2025-01-15", ClosePrice: testPrice("236.60"), OpenPrice: testPrice("0.1")}
+	data, err := json.Marshal(bar)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := `{"date":"2025-01-15","open":0.1,"high":0,"low":0,"close":236.6,"volume":0}`
+	if string(data) != expected {
+		t.Errorf("Expected %s, got %s", expected, data)
+	}
+
+	var decoded struct {
+		Number Price `json:"number"`
+		String Price `json:"string"`
+	}
+	if err := json.Unmarshal([]byte(`{"number": 236.6, "string": "234.5000"}`), &decoded); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if decoded.Number != testPrice("236.6") || decoded.String != testPrice("234.5") {
+		t.Errorf("Expected 236.6 and 234.5, got %v and %v", decoded.Number, decoded.String)
+	}
+
+	if err := json.Unmarshal([]byte(`{"number": 1.23456}`), &decoded); err == nil {
+		t.Error("Expected error for a value with too many decimal places, got nil")
+	}
+}
+
+func TestPriceDiv(t *testing.T) {
+	tests := []struct {
+		name     string
+		price    Price
+		n        int64
+		rounding Rounding
+		expected Price
+	}{
+		{"Exact", testPrice("473.2"), 2, Rounding{}, testPrice("236.6")},
+		{"Zero rounding keeps every place", testPrice("10"), 3, Rounding{}, testPrice("3.3333")},
+		{"Half even rounds ties to even", testPrice("0.25"), 1, Rounding{Mode: RoundHalfEven, Decimals: 1}, testPrice("0.2")},
+		{"Half even rounds other ties up", testPrice("0.35"), 1, Rounding{Mode: RoundHalfEven, Decimals: 1}, testPrice("0.4")},
+		{"Half up rounds ties away from zero", testPrice("0.25"), 1, Rounding{Mode: RoundHalfUp, Decimals: 1}, testPrice("0.3")},
+		{"Half up on a negative value", testPrice("-0.25"), 1, Rounding{Mode: RoundHalfUp, Decimals: 1}, testPrice("-0.3")},
+		{"Down truncates", testPrice("20"), 3, Rounding{Mode: RoundDown, Decimals: 2}, testPrice("6.66")},
+		{"Nearest", testPrice("20"), 3, Rounding{Mode: RoundHalfEven, Decimals: 2}, testPrice("6.67")},
+		{"Whole numbers", testPrice("705.3"), 3, Rounding{Mode: RoundHalfEven, Decimals: 0}, testPrice("235")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.price.Div(tt.n, tt.rounding); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestAverageCloseIsExact(t *testing.T) {
+	// Summing these as float64 gives 236.60000000000002
+	data := []TimeSeriesData{
+		{Date: "2025-01-15", ClosePrice: testPrice("236.40")},
+		{Date: "2025-01-14", ClosePrice: testPrice("236.80")},
+	}
+
+	if got := averageClose(data, Rounding{}); got.String() != "236.6" {
+		t.Errorf("Expected average close 236.6, got %v", got)
+	}
+	if got := averageClose(nil, Rounding{}); got != 0 {
+		t.Errorf("Expected 0 for no data, got %v", got)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Errors reported by providers. Implementations wrap these so handlers can
+// map them to HTTP responses with errors.Is.
+var (
+	// ErrRateLimited means the vendor throttled the request
+	ErrRateLimited = errors.New("upstream rate limit exceeded")
+	// ErrInvalidSymbol means the vendor does not know the symbol
+	ErrInvalidSymbol = errors.New("invalid symbol")
+	// ErrInvalidAPIKey means the vendor rejected our API key
+	ErrInvalidAPIKey = errors.New("invalid API key")
+	// ErrUpstream means the vendor returned some other error
+	ErrUpstream = errors.New("upstream error")
+)
+
+// Provider fetches daily bars from a market data vendor
+type Provider interface {
+	// Name identifies the provider in configuration and logs
+	Name() string
+	// DailyBars returns the daily bars the vendor has for symbol. The result
+	// must cover at least the most recent nDays trading days when available,
+	// but may contain more and need not be sorted. The upstream call is
+	// abandoned when ctx is done.
+	DailyBars(ctx context.Context, symbol string, nDays int) ([]TimeSeriesData, error)
+}
+
+// ProviderFactory builds a Provider from the application configuration
+type ProviderFactory func(config *Config, client HTTPClient) Provider
+
+// defaultProvider is used when no PROVIDER is configured
+const defaultProvider = providerAlphaVantage
+
+// providerSpec describes a registered provider
+type providerSpec struct {
+	New ProviderFactory
+	// Limits is the vendor's default call quota
+	Limits RateLimits
+	// Throttled detects throttle notices sent as successful responses
+	Throttled ThrottleDetector
+}
+
+// providers maps the PROVIDER setting to the spec for that vendor.
+// New vendors register themselves here.
+var providers = map[string]providerSpec{
+	providerAlphaVantage: {
+		New:       newAlphaVantageProvider,
+		Limits:    alphaVantageRateLimits,
+		Throttled: alphaVantageThrottled,
+	},
+}
+
+// providerNames returns the registered provider names in sorted order
+func providerNames() []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseProviderName validates a provider name, defaulting when empty
+func parseProviderName(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return defaultProvider, nil
+	}
+	if _, ok := providers[name]; !ok {
+		return "", fmt.Errorf("unknown provider %q: must be one of %s", name, strings.Join(providerNames(), ", "))
+	}
+	return name, nil
+}
+
+// newProvider returns the provider selected by the configuration, reporting
+// its calls to monitor and metrics when either is given and wrapped in a
+// cache when CACHE_TTL is enabled
+func newProvider(config *Config, client HTTPClient, monitor *UpstreamMonitor, metrics *Metrics) (Provider, error) {
+	name, err := parseProviderName(config.Provider)
+	if err != nil {
+		return nil, err
+	}
+	provider := providers[name].New(config, client)
+	if monitor != nil || metrics != nil {
+		provider = &monitoredProvider{Provider: provider, Monitor: monitor, Metrics: metrics}
+	}
+	if config.CacheTTL > 0 {
+		cache := NewCachingProvider(provider, config.CacheTTL, config.CacheStaleTTL, config.CacheMaxStale)
+		cache.Metrics = metrics
+		provider = cache
+	}
+	return provider, nil
+}
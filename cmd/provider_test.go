@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+// MockProvider is a mock implementation of Provider for testing
+type MockProvider struct {
+	DailyBarsFunc func(ctx context.Context, symbol string, nDays int) ([]TimeSeriesData, error)
+}
+
+// Name implements the Provider interface
+func (m *MockProvider) Name() string {
+	return "mock"
+}
+
+// DailyBars implements the Provider interface
+func (m *MockProvider) DailyBars(ctx context.Context, symbol string, nDays int) ([]TimeSeriesData, error) {
+	return m.DailyBarsFunc(ctx, symbol, nDays)
+}
+
+func TestParseProviderName(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		expected    string
+		expectError bool
+	}{
+		{name: "Empty defaults to Alpha Vantage", input: "", expected: providerAlphaVantage},
+		{name: "Alpha Vantage", input: "alphavantage", expected: providerAlphaVantage},
+		{name: "Case insensitive", input: "AlphaVantage", expected: providerAlphaVantage},
+		{name: "Unknown provider", input: "bloomberg", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, err := parseProviderName(tt.input)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error, got provider %q", name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if name != tt.expected {
+				t.Errorf("Expected provider %q, got %q", tt.expected, name)
+			}
+		})
+	}
+}
+
+func TestNewProvider(t *testing.T) {
+	config := &Config{APIKey: "test-api-key", Provider: providerAlphaVantage}
+
+	provider, err := newProvider(config, &MockHTTPClient{}, nil, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	avProvider, ok := provider.(*AlphaVantageProvider)
+	if !ok {
+		t.Fatalf("Expected *AlphaVantageProvider, got %T", provider)
+	}
+	if avProvider.APIKey != "test-api-key" {
+		t.Errorf("Expected API key to be passed through, got %q", avProvider.APIKey)
+	}
+
+	if _, err := newProvider(&Config{Provider: "unknown"}, &MockHTTPClient{}, nil, nil); err == nil {
+		t.Error("Expected error for unknown provider, got nil")
+	}
+}
+
+func TestFetchStockDataUsesProvider(t *testing.T) {
+	var gotSymbol string
+	var gotDays int
+	provider := &MockProvider{
+		DailyBarsFunc: func(ctx context.Context, symbol string, nDays int) ([]TimeSeriesData, error) {
+			gotSymbol, gotDays = symbol, nDays
+			return []TimeSeriesData{
+				{Date: "2025-01-13", ClosePrice: testPrice("10")},
+				{Date: "2025-01-15", ClosePrice: testPrice("30")},
+				{Date: "2025-01-14", ClosePrice: testPrice("20")},
+			}, nil
+		},
+	}
+
+	resp, err := fetchStockData(context.Background(), provider, stockQuery{Symbol: "MSFT", Days: 2, Order: OrderAscending})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if gotSymbol != "MSFT" || gotDays != 2 {
+		t.Errorf("Expected provider call for MSFT/2, got %s/%d", gotSymbol, gotDays)
+	}
+	if resp.Symbol != "MSFT" || resp.Days != 2 {
+		t.Errorf("Expected response for MSFT/2, got %s/%d", resp.Symbol, resp.Days)
+	}
+	if len(resp.Data) != 2 || resp.Data[0].Date != "2025-01-14" || resp.Data[1].Date != "2025-01-15" {
+		t.Errorf("Expected the two most recent days in ascending order, got %+v", resp.Data)
+	}
+	if resp.AverageClose != testPrice("25") {
+		t.Errorf("Expected average close 25, got %v", resp.AverageClose)
+	}
+	if resp.AvailableDays != 2 {
+		t.Errorf("Expected 2 available days, got %d", resp.AvailableDays)
+	}
+
+	resp, err = fetchStockData(context.Background(), provider, stockQuery{Symbol: "MSFT", Days: 10, Order: OrderAscending})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if resp.Days != 10 || resp.AvailableDays != 3 {
+		t.Errorf("Expected 3 of 10 days to be available, got %d of %d", resp.AvailableDays, resp.Days)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// defaultMaxDays is the largest day count a request may ask for unless
+// MAX_DAYS says otherwise
+const defaultMaxDays = 100
+
+// symbolPattern matches the ticker symbols we accept, e.g. MSFT or BRK.B
+var symbolPattern = regexp.MustCompile(`^[A-Z0-9][A-Z0-9.\-]{0,9}$`)
+
+// stockQuery holds the parameters of a single stock data request
+type stockQuery struct {
+	Symbol string
+	Days   int
+	Order  SortOrder
+	// Rounding says how the average close and statistics are rounded
+	Rounding Rounding
+	// Stats selects the statistics reported with the data
+	Stats statSet
+	// Returns says whether daily returns are reported, over a rolling
+	// volatility window of VolatilityWindow days
+	Returns          ReturnsMode
+	VolatilityWindow int
+}
+
+// defaultStockQuery returns the query described by the configuration
+func defaultStockQuery(config *Config) stockQuery {
+	return stockQuery{
+		Symbol:   config.Symbol,
+		Days:     config.NDays,
+		Order:    config.Order,
+		Rounding: config.AverageRounding,
+	}
+}
+
+// QueryError reports an invalid request parameter
+type QueryError struct {
+	Param   string
+	Message string
+}
+
+// Error implements the error interface
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Param, e.Message)
+}
+
+// parseSymbol validates and normalizes a ticker symbol
+func parseSymbol(s string) (string, error) {
+	symbol := strings.ToUpper(strings.TrimSpace(s))
+	if !symbolPattern.MatchString(symbol) {
+		return "", fmt.Errorf("must be 1-10 letters, digits, '.' or '-', got %q", s)
+	}
+	return symbol, nil
+}
+
+// parseDays validates a day count against the allowed bounds
+func parseDays(s string, maxDays int) (int, error) {
+	days, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("must be a number, got %q", s)
+	}
+	if days < 1 || days > maxDays {
+		return 0, fmt.Errorf("must be between 1 and %d, got %d", maxDays, days)
+	}
+	return days, nil
+}
+
+// parseStockQuery reads the symbol, days, order, stats and returns query
+// parameters, falling back to the configured defaults for any that are absent
+func parseStockQuery(values url.Values, config *Config) (stockQuery, error) {
+	query := defaultStockQuery(config)
+
+	if s := values.Get("symbol"); s != "" {
+		symbol, err := parseSymbol(s)
+		if err != nil {
+			return stockQuery{}, &QueryError{Param: "symbol", Message: err.Error()}
+		}
+		query.Symbol = symbol
+	}
+
+	if err := parseDaysAndOrder(values, config, &query); err != nil {
+		return stockQuery{}, err
+	}
+
+	if s := values.Get("stats"); s != "" {
+		stats, err := parseStats(s)
+		if err != nil {
+			return stockQuery{}, &QueryError{Param: "stats", Message: err.Error()}
+		}
+		query.Stats = stats
+	}
+
+	if s := values.Get("returns"); s != "" {
+		mode, err := parseReturnsMode(s)
+		if err != nil {
+			return stockQuery{}, &QueryError{Param: "returns", Message: err.Error()}
+		}
+		query.Returns = mode
+		query.VolatilityWindow = defaultVolatilityWindow
+	}
+
+	if s := values.Get("volatility_window"); s != "" && query.Returns != ReturnsNone {
+		window, err := parseVolatilityWindow(s)
+		if err != nil {
+			return stockQuery{}, &QueryError{Param: "volatility_window", Message: err.Error()}
+		}
+		query.VolatilityWindow = window
+	}
+
+	return query, nil
+}
+
+// parseDaysAndOrder reads the days and order query parameters into query,
+// leaving its values for any that are absent
+func parseDaysAndOrder(values url.Values, config *Config, query *stockQuery) error {
+	if s := values.Get("days"); s != "" {
+		days, err := parseDays(s, config.MaxDays)
+		if err != nil {
+			return &QueryError{Param: "days", Message: err.Error()}
+		}
+		query.Days = days
+	}
+
+	if s := values.Get("order"); s != "" {
+		order, err := parseSortOrder(s)
+		if err != nil {
+			return &QueryError{Param: "order", Message: err.Error()}
+		}
+		query.Order = order
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseStockQuery(t *testing.T) {
+	config := &Config{
+		Symbol:  "AAPL",
+		NDays:   5,
+		Order:   OrderDescending,
+		MaxDays: 100,
+	}
+
+	tests := []struct {
+		name          string
+		rawQuery      string
+		expected      stockQuery
+		expectedParam string
+	}{
+		{
+			name:     "No parameters uses config defaults",
+			rawQuery: "",
+			expected: stockQuery{Symbol: "AAPL", Days: 5, Order: OrderDescending},
+		},
+		{
+			name:     "Symbol and days override",
+			rawQuery: "symbol=IBM&days=30",
+			expected: stockQuery{Symbol: "IBM", Days: 30, Order: OrderDescending},
+		},
+		{
+			name:     "Symbol is normalized to upper case",
+			rawQuery: "symbol=brk.b",
+			expected: stockQuery{Symbol: "BRK.B", Days: 5, Order: OrderDescending},
+		},
+		{
+			name:     "Order override",
+			rawQuery: "order=asc",
+			expected: stockQuery{Symbol: "AAPL", Days: 5, Order: OrderAscending},
+		},
+		{
+			name:     "Maximum days",
+			rawQuery: "days=100",
+			expected: stockQuery{Symbol: "AAPL", Days: 100, Order: OrderDescending},
+		},
+		{
+			name:     "Stats selection",
+			rawQuery: "stats=VWAP,min_close",
+			expected: stockQuery{Symbol: "AAPL", Days: 5, Order: OrderDescending, Stats: statSet{statVWAP: true, statMinClose: true}},
+		},
+		{
+			name:     "Returns use the default volatility window",
+			rawQuery: "returns=include",
+			expected: stockQuery{Symbol: "AAPL", Days: 5, Order: OrderDescending, Returns: ReturnsInclude, VolatilityWindow: defaultVolatilityWindow},
+		},
+		{
+			name:     "Volatility window override",
+			rawQuery: "returns=only&volatility_window=60",
+			expected: stockQuery{Symbol: "AAPL", Days: 5, Order: OrderDescending, Returns: ReturnsOnly, VolatilityWindow: 60},
+		},
+		{
+			name:     "Volatility window without returns is ignored",
+			rawQuery: "volatility_window=60",
+			expected: stockQuery{Symbol: "AAPL", Days: 5, Order: OrderDescending},
+		},
+		{name: "Symbol with invalid characters", rawQuery: "symbol=AA%3BPL", expectedParam: "symbol"},
+		{name: "Symbol too long", rawQuery: "symbol=ABCDEFGHIJK", expectedParam: "symbol"},
+		{name: "Days not a number", rawQuery: "days=ten", expectedParam: "days"},
+		{name: "Days zero", rawQuery: "days=0", expectedParam: "days"},
+		{name: "Days negative", rawQuery: "days=-3", expectedParam: "days"},
+		{name: "Days above maximum", rawQuery: "days=101", expectedParam: "days"},
+		{name: "Invalid order", rawQuery: "order=up", expectedParam: "order"},
+		{name: "Unknown statistic", rawQuery: "stats=mean", expectedParam: "stats"},
+		{name: "Invalid returns mode", rawQuery: "returns=yes", expectedParam: "returns"},
+		{name: "Volatility window too short", rawQuery: "returns=include&volatility_window=1", expectedParam: "volatility_window"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.rawQuery)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			query, err := parseStockQuery(values, config)
+			if tt.expectedParam != "" {
+				var queryErr *QueryError
+				if !errors.As(err, &queryErr) {
+					t.Fatalf("Expected *QueryError, got %v", err)
+				}
+				if queryErr.Param != tt.expectedParam {
+					t.Errorf("Expected error for %s, got %s", tt.expectedParam, queryErr.Param)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(query, tt.expected) {
+				t.Errorf("Expected query %+v, got %+v", tt.expected, query)
+			}
+		})
+	}
+}
+
+func TestCreateHandlerQueryParameters(t *testing.T) {
+	config := &Config{
+		Symbol:  "AAPL",
+		NDays:   5,
+		Order:   OrderDescending,
+		MaxDays: 100,
+	}
+
+	var gotSymbol string
+	var gotDays int
+	provider := &MockProvider{
+		DailyBarsFunc: func(ctx context.Context, symbol string, nDays int) ([]TimeSeriesData, error) {
+			gotSymbol, gotDays = symbol, nDays
+			return []TimeSeriesData{{Date: "2025-01-15", ClosePrice: testPrice("100")}}, nil
+		},
+	}
+	handler := createHandler(config, provider)
+
+	t.Run("Overrides are passed to the provider", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/?symbol=ibm&days=30", nil))
+
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, recorder.Code)
+		}
+		if gotSymbol != "IBM" || gotDays != 30 {
+			t.Errorf("Expected provider call for IBM/30, got %s/%d", gotSymbol, gotDays)
+		}
+		if !strings.Contains(recorder.Body.String(), `"symbol":"IBM"`) {
+			t.Errorf("Expected response for IBM, got %s", recorder.Body.String())
+		}
+	})
+
+	t.Run("Invalid parameters return bad request", func(t *testing.T) {
+		gotSymbol = ""
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/?days=1000", nil))
+
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, recorder.Code)
+		}
+		if !strings.Contains(recorder.Body.String(), "invalid days") {
+			t.Errorf("Expected body to describe the invalid parameter, got %s", recorder.Body.String())
+		}
+		if gotSymbol != "" {
+			t.Error("Expected no provider call for an invalid request")
+		}
+	})
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimitMode controls what happens to a call when the budget is exhausted
+type RateLimitMode string
+
+const (
+	// RateLimitQueue waits for budget up to the configured maximum wait
+	RateLimitQueue RateLimitMode = "queue"
+	// RateLimitReject fails the call straight away
+	RateLimitReject RateLimitMode = "reject"
+)
+
+// defaultRateLimitMaxWait is how long a queued call may wait for budget
+// unless RATE_LIMIT_MAX_WAIT says otherwise
+const defaultRateLimitMaxWait = 10 * time.Second
+
+// parseRateLimitMode parses a rate limit mode, defaulting to queue when empty
+func parseRateLimitMode(s string) (RateLimitMode, error) {
+	switch RateLimitMode(strings.ToLower(strings.TrimSpace(s))) {
+	case "", RateLimitQueue:
+		return RateLimitQueue, nil
+	case RateLimitReject:
+		return RateLimitReject, nil
+	default:
+		return "", fmt.Errorf("invalid rate limit mode %q: must be %q or %q", s, RateLimitQueue, RateLimitReject)
+	}
+}
+
+// RateLimits is a provider's call quota. Zero means unlimited.
+type RateLimits struct {
+	PerMinute int
+	PerDay    int
+}
+
+// tokenBucket holds up to capacity tokens, refilled continuously so that
+// the bucket fills once per window
+type tokenBucket struct {
+	name     string
+	capacity float64
+	window   time.Duration
+	tokens   float64
+	last     time.Time
+}
+
+// newTokenBucket returns a full bucket
+func newTokenBucket(name string, capacity int, window time.Duration) *tokenBucket {
+	return &tokenBucket{
+		name:     name,
+		capacity: float64(capacity),
+		window:   window,
+		tokens:   float64(capacity),
+	}
+}
+
+// refill adds the tokens accrued since the last refill
+func (b *tokenBucket) refill(now time.Time) {
+	if b.last.IsZero() {
+		b.last = now
+		return
+	}
+	elapsed := now.Sub(b.last)
+	if elapsed <= 0 {
+		return
+	}
+	b.tokens = math.Min(b.capacity, b.tokens+b.capacity*float64(elapsed)/float64(b.window))
+	b.last = now
+}
+
+// wait returns how long until a token is available
+func (b *tokenBucket) wait() time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.capacity * float64(b.window))
+}
+
+// RateLimiter enforces a provider's per-minute and per-day call budgets
+type RateLimiter struct {
+	Mode    RateLimitMode
+	MaxWait time.Duration
+
+	now     func() time.Time
+	sleep   func(context.Context, time.Duration) error
+	mu      sync.Mutex
+	buckets []*tokenBucket
+}
+
+// NewRateLimiter returns a limiter for the given limits
+func NewRateLimiter(limits RateLimits, mode RateLimitMode, maxWait time.Duration) *RateLimiter {
+	l := &RateLimiter{
+		Mode:    mode,
+		MaxWait: maxWait,
+		now:     time.Now,
+		sleep:   sleepContext,
+	}
+
+	if limits.PerMinute > 0 {
+		l.buckets = append(l.buckets, newTokenBucket("minute", limits.PerMinute, time.Minute))
+	}
+	if limits.PerDay > 0 {
+		l.buckets = append(l.buckets, newTokenBucket("day", limits.PerDay, 24*time.Hour))
+	}
+	return l
+}
+
+// reserve takes a token from every bucket if all have one, otherwise it
+// returns how long until they will
+func (l *RateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if wait := l.waitLocked(); wait > 0 {
+		return wait
+	}
+	for _, b := range l.buckets {
+		b.tokens--
+	}
+	return 0
+}
+
+// waitLocked refills the buckets and returns how long until all of them
+// have a token. l.mu must be held.
+func (l *RateLimiter) waitLocked() time.Duration {
+	now := l.now()
+	var wait time.Duration
+	for _, b := range l.buckets {
+		b.refill(now)
+		if w := b.wait(); w > wait {
+			wait = w
+		}
+	}
+	return wait
+}
+
+// Available reports whether a call made now would be allowed without
+// taking any budget
+func (l *RateLimiter) Available() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	wait := l.waitLocked()
+	if l.Mode == RateLimitReject {
+		return wait == 0
+	}
+	return wait <= l.MaxWait
+}
+
+// Wait blocks until a call is within budget. In reject mode, or when the
+// budget will not recover within MaxWait or before ctx's deadline, it
+// returns an error wrapping ErrRateLimited instead. If ctx is done while
+// waiting, its error is returned.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	var waited time.Duration
+	for {
+		wait := l.reserve()
+		if wait == 0 {
+			return nil
+		}
+		if l.Mode == RateLimitReject || waited+wait > l.MaxWait || l.pastDeadline(ctx, wait) {
+			return fmt.Errorf("%w: local call budget exhausted, next call allowed in %s", ErrRateLimited, wait.Round(time.Second))
+		}
+		if err := l.sleep(ctx, wait); err != nil {
+			return err
+		}
+		waited += wait
+	}
+}
+
+// pastDeadline reports whether waiting wait would run past ctx's deadline
+func (l *RateLimiter) pastDeadline(ctx context.Context, wait time.Duration) bool {
+	deadline, ok := ctx.Deadline()
+	return ok && l.now().Add(wait).After(deadline)
+}
+
+// sleepContext sleeps for d, returning early with ctx's error if ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// RateLimitStatus reports the remaining budget in one window
+type RateLimitStatus struct {
+	Window    string `json:"window"`
+	Limit     int    `json:"limit"`
+	Remaining int    `json:"remaining"`
+}
+
+// Status returns the remaining budget in each window
+func (l *RateLimiter) Status() []RateLimitStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	status := make([]RateLimitStatus, 0, len(l.buckets))
+	for _, b := range l.buckets {
+		b.refill(now)
+		status = append(status, RateLimitStatus{
+			Window:    b.name,
+			Limit:     int(b.capacity),
+			Remaining: int(math.Floor(b.tokens)),
+		})
+	}
+	return status
+}
+
+// RateLimitedClient is an HTTPClient that keeps calls within a RateLimiter
+type RateLimitedClient struct {
+	Client  HTTPClient
+	Limiter *RateLimiter
+}
+
+// Get implements the HTTPClient interface
+func (c *RateLimitedClient) Get(ctx context.Context, url string) (*http.Response, error) {
+	if err := c.Limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	return c.Client.Get(ctx, url)
+}
+
+// StatusResponse is the API response format for the status endpoint
+type StatusResponse struct {
+	Provider  string            `json:"provider"`
+	RateLimit RateLimitResponse `json:"rate_limit"`
+}
+
+// RateLimitResponse describes the outbound rate limit in StatusResponse
+type RateLimitResponse struct {
+	Mode    RateLimitMode     `json:"mode"`
+	Windows []RateLimitStatus `json:"windows"`
+}
+
+// createStatusHandler creates the HTTP handler for the status endpoint
+func createStatusHandler(provider Provider, limiter *RateLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, r, http.MethodGet)
+			return
+		}
+
+		response := StatusResponse{
+			Provider: provider.Name(),
+			RateLimit: RateLimitResponse{
+				Mode:    limiter.Mode,
+				Windows: limiter.Status(),
+			},
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			slog.ErrorContext(r.Context(), "Error encoding response", "error", err)
+		}
+	}
+}
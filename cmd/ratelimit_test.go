@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestLimiter returns a limiter driven by clock whose sleeps advance it
+func newTestLimiter(limits RateLimits, mode RateLimitMode, maxWait time.Duration, clock *fakeClock) *RateLimiter {
+	limiter := NewRateLimiter(limits, mode, maxWait)
+	limiter.now = clock.Now
+	limiter.sleep = func(ctx context.Context, d time.Duration) error {
+		clock.Advance(d)
+		return nil
+	}
+	return limiter
+}
+
+func TestParseRateLimitMode(t *testing.T) {
+	for input, expected := range map[string]RateLimitMode{"": RateLimitQueue, "queue": RateLimitQueue, "REJECT": RateLimitReject} {
+		mode, err := parseRateLimitMode(input)
+		if err != nil || mode != expected {
+			t.Errorf("parseRateLimitMode(%q) = %q, %v; expected %q", input, mode, err, expected)
+		}
+	}
+	if _, err := parseRateLimitMode("drop"); err == nil {
+		t.Error("Expected error for invalid mode, got nil")
+	}
+}
+
+func TestRateLimiterReject(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)}
+	limiter := newTestLimiter(RateLimits{PerMinute: 5}, RateLimitReject, time.Minute, clock)
+
+	for i := 0; i < 5; i++ {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatalf("Call %d: unexpected error: %v", i, err)
+		}
+	}
+
+	err := limiter.Wait(context.Background())
+	if !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("Expected ErrRateLimited once the budget is spent, got %v", err)
+	}
+
+	// One token refills every 12 seconds
+	clock.Advance(12 * time.Second)
+	if err := limiter.Wait(context.Background()); err != nil {
+		t.Errorf("Expected a call to be allowed after refill, got %v", err)
+	}
+}
+
+func TestRateLimiterQueue(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)}
+	limiter := newTestLimiter(RateLimits{PerMinute: 5}, RateLimitQueue, 15*time.Second, clock)
+
+	for i := 0; i < 5; i++ {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatalf("Call %d: unexpected error: %v", i, err)
+		}
+	}
+
+	start := clock.Now()
+	if err := limiter.Wait(context.Background()); err != nil {
+		t.Fatalf("Expected the call to be queued, got %v", err)
+	}
+	if waited := clock.Now().Sub(start); waited != 12*time.Second {
+		t.Errorf("Expected to wait 12s for a token, waited %s", waited)
+	}
+
+	// The next token is another 12s away, longer than a 5s max wait
+	limiter.MaxWait = 5 * time.Second
+	if err := limiter.Wait(context.Background()); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected ErrRateLimited when the wait exceeds the maximum, got %v", err)
+	}
+}
+
+func TestRateLimiterDailyBudget(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)}
+	limiter := newTestLimiter(RateLimits{PerMinute: 5, PerDay: 6}, RateLimitQueue, time.Minute, clock)
+
+	for i := 0; i < 6; i++ {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatalf("Call %d: unexpected error: %v", i, err)
+		}
+	}
+
+	// The minute bucket recovers within the max wait, the day bucket does not
+	if err := limiter.Wait(context.Background()); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected the daily budget to reject the call, got %v", err)
+	}
+
+	status := limiter.Status()
+	if len(status) != 2 || status[1].Window != "day" || status[1].Remaining != 0 || status[1].Limit != 6 {
+		t.Errorf("Expected an exhausted daily window, got %+v", status)
+	}
+}
+
+func TestRateLimiterContext(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	limiter := newTestLimiter(RateLimits{PerMinute: 5}, RateLimitQueue, time.Minute, clock)
+	for i := 0; i < 5; i++ {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatalf("Call %d: unexpected error: %v", i, err)
+		}
+	}
+
+	// The next token is 12s away, past the caller's deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := limiter.Wait(ctx); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected ErrRateLimited when the wait passes the deadline, got %v", err)
+	}
+
+	// A cancelled caller stops queueing
+	limiter.sleep = sleepContext
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if err := limiter.Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestRateLimiterUnlimited(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)}
+	limiter := newTestLimiter(RateLimits{}, RateLimitReject, 0, clock)
+
+	for i := 0; i < 1000; i++ {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatalf("Expected no limit, got %v", err)
+		}
+	}
+	if status := limiter.Status(); len(status) != 0 {
+		t.Errorf("Expected no windows, got %+v", status)
+	}
+}
+
+func TestRateLimitedClient(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)}
+	limiter := newTestLimiter(RateLimits{PerMinute: 1}, RateLimitReject, 0, clock)
+
+	var calls int
+	client := &RateLimitedClient{
+		Client: &MockHTTPClient{
+			DoFunc: func(ctx context.Context, url string) (*http.Response, error) {
+				calls++
+				return &http.Response{StatusCode: http.StatusOK}, nil
+			},
+		},
+		Limiter: limiter,
+	}
+
+	if _, err := client.Get(context.Background(), "https://example.com"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := client.Get(context.Background(), "https://example.com"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected ErrRateLimited, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Expected the rejected call not to reach the client, got %d calls", calls)
+	}
+}
+
+func TestCreateStatusHandler(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)}
+	limiter := newTestLimiter(alphaVantageRateLimits, RateLimitQueue, time.Second, clock)
+	if err := limiter.Wait(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	createStatusHandler(&MockProvider{}, limiter).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v1/status", nil))
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, recorder.Code)
+	}
+
+	var response StatusResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	expected := []RateLimitStatus{
+		{Window: "minute", Limit: 5, Remaining: 4},
+		{Window: "day", Limit: 25, Remaining: 24},
+	}
+	if response.Provider != "mock" || response.RateLimit.Mode != RateLimitQueue {
+		t.Errorf("Unexpected status %+v", response)
+	}
+	if len(response.RateLimit.Windows) != 2 || response.RateLimit.Windows[0] != expected[0] || response.RateLimit.Windows[1] != expected[1] {
+		t.Errorf("Expected windows %+v, got %+v", expected, response.RateLimit.Windows)
+	}
+}
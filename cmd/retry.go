@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// defaultRetryMaxAttempts is how many times an upstream call is tried
+	// unless RETRY_MAX_ATTEMPTS says otherwise
+	defaultRetryMaxAttempts = 3
+	// defaultRetryBaseDelay is the backoff before the first retry unless
+	// RETRY_BASE_DELAY says otherwise
+	defaultRetryBaseDelay = 500 * time.Millisecond
+	// defaultRetryMaxDelay caps the backoff between retries unless
+	// RETRY_MAX_DELAY says otherwise
+	defaultRetryMaxDelay = 5 * time.Second
+)
+
+// ThrottleDetector reports whether a successful response body is actually
+// a transient throttle notice that is worth retrying
+type ThrottleDetector func(body []byte) bool
+
+// RetryingClient is an HTTPClient that retries transient upstream failures
+// with capped exponential backoff and full jitter. Network errors, 5xx and
+// 429 responses, and bodies flagged by Throttled are retried.
+type RetryingClient struct {
+	Client      HTTPClient
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Throttled   ThrottleDetector
+
+	// jitter returns a random duration in [0, d)
+	jitter func(d time.Duration) time.Duration
+}
+
+// NewRetryingClient wraps client with the given retry policy
+func NewRetryingClient(client HTTPClient, maxAttempts int, baseDelay, maxDelay time.Duration, throttled ThrottleDetector) *RetryingClient {
+	return &RetryingClient{
+		Client:      client,
+		MaxAttempts: maxAttempts,
+		BaseDelay:   baseDelay,
+		MaxDelay:    maxDelay,
+		Throttled:   throttled,
+		jitter: func(d time.Duration) time.Duration {
+			if d <= 0 {
+				return 0
+			}
+			return rand.N(d)
+		},
+	}
+}
+
+// Get implements the HTTPClient interface. No further attempts are made
+// once ctx is done, and the backoff between attempts is cut short.
+func (c *RetryingClient) Get(ctx context.Context, url string) (*http.Response, error) {
+	maxAttempts := max(c.MaxAttempts, 1)
+
+	for attempt := 1; ; attempt++ {
+		resp, err := c.Client.Get(ctx, url)
+		reason, retry, readErr := c.classify(ctx, resp, err)
+		if !retry {
+			if attempt > 1 {
+				slog.InfoContext(ctx, "Upstream call finished after retries", "attempts", attempt)
+			}
+			return resp, err
+		}
+
+		if attempt >= maxAttempts {
+			slog.WarnContext(ctx, "Upstream call failed after retries", "attempts", attempt, "reason", reason)
+			if readErr != nil {
+				err = fmt.Errorf("error reading response body: %w", readErr)
+			}
+			if err == nil {
+				return resp, nil
+			}
+			return nil, fmt.Errorf("%w (after %d attempts)", err, attempt)
+		}
+
+		if resp != nil {
+			_ = resp.Body.Close()
+		}
+
+		delay := c.backoff(attempt)
+		slog.InfoContext(ctx, "Retrying upstream call", "attempt", attempt, "max_attempts", maxAttempts, "reason", reason, "delay", delay.Round(time.Millisecond).String())
+
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, fmt.Errorf("retry aborted after %d attempts: %w", attempt, err)
+		}
+	}
+}
+
+// classify decides whether an attempt should be retried, describing why
+// without including the request URL. A per-call timeout is retried, but
+// nothing is once the caller's ctx is done. readErr is set when the body
+// could not be read in full, leaving resp holding a truncated body.
+func (c *RetryingClient) classify(ctx context.Context, resp *http.Response, err error) (reason string, retry bool, readErr error) {
+	if ctx.Err() != nil {
+		return "", false, nil
+	}
+	if err != nil {
+		if errors.Is(err, ErrRateLimited) {
+			return "", false, nil
+		}
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return fmt.Sprintf("network error: %v", urlErr.Err), true, nil
+		}
+		return fmt.Sprintf("network error: %v", err), true, nil
+	}
+
+	if resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests {
+		return fmt.Sprintf("HTTP status %d", resp.StatusCode), true, nil
+	}
+
+	if c.Throttled == nil || resp.Body == nil {
+		return "", false, nil
+	}
+
+	// Read the body so it can be inspected and then handed back unchanged
+	body, readErr := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if readErr != nil {
+		return fmt.Sprintf("error reading response body: %v", readErr), true, readErr
+	}
+	if c.Throttled(body) {
+		return "upstream throttled the request", true, nil
+	}
+	return "", false, nil
+}
+
+// backoff returns the jittered delay before the retry following attempt
+func (c *RetryingClient) backoff(attempt int) time.Duration {
+	delay := c.BaseDelay << (attempt - 1)
+	if delay > c.MaxDelay || delay <= 0 {
+		delay = c.MaxDelay
+	}
+	return c.jitter(delay)
+}
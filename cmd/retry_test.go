@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// scriptedClient returns the scripted results in order, one per call
+type scriptedClient struct {
+	results []func() (*http.Response, error)
+	calls   int
+}
+
+func (c *scriptedClient) Get(ctx context.Context, url string) (*http.Response, error) {
+	result := c.results[min(c.calls, len(c.results)-1)]
+	c.calls++
+	return result()
+}
+
+func respond(status int, body string) func() (*http.Response, error) {
+	return func() (*http.Response, error) {
+		return &http.Response{StatusCode: status, Body: io.NopCloser(bytes.NewBufferString(body))}, nil
+	}
+}
+
+func fail(err error) func() (*http.Response, error) {
+	return func() (*http.Response, error) {
+		return nil, err
+	}
+}
+
+// truncated returns a response whose body fails with err after part of it
+func truncated(err error) func() (*http.Response, error) {
+	return func() (*http.Response, error) {
+		body := io.MultiReader(bytes.NewBufferString(`{"Time Series`), iotest.ErrReader(err))
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(body)}, nil
+	}
+}
+
+// newTestRetryingClient returns a RetryingClient without jitter or real delays
+func newTestRetryingClient(client HTTPClient, maxAttempts int) *RetryingClient {
+	retrying := NewRetryingClient(client, maxAttempts, time.Microsecond, 4*time.Microsecond, alphaVantageThrottled)
+	retrying.jitter = func(d time.Duration) time.Duration { return d }
+	return retrying
+}
+
+func TestRetryingClient(t *testing.T) {
+	networkErr := &url.Error{Op: "Get", URL: "https://www.alphavantage.co/query?apikey=secret", Err: fmt.Errorf("connection reset")}
+	throttle := `{"Note": "Our standard API call frequency is 5 calls per minute and 500 calls per day."}`
+	dailyLimit := `{"Information": "Our standard API rate limit is 25 requests per day."}`
+	series := `{"Time Series (Daily)": {}}`
+
+	tests := []struct {
+		name          string
+		results       []func() (*http.Response, error)
+		expectedCalls int
+		expectedBody  string
+		expectError   bool
+	}{
+		{
+			name:          "Success needs no retry",
+			results:       []func() (*http.Response, error){respond(http.StatusOK, series)},
+			expectedCalls: 1,
+			expectedBody:  series,
+		},
+		{
+			name:          "Network error then success",
+			results:       []func() (*http.Response, error){fail(networkErr), respond(http.StatusOK, series)},
+			expectedCalls: 2,
+			expectedBody:  series,
+		},
+		{
+			name:          "Server errors then success",
+			results:       []func() (*http.Response, error){respond(http.StatusBadGateway, ""), respond(http.StatusServiceUnavailable, ""), respond(http.StatusOK, series)},
+			expectedCalls: 3,
+			expectedBody:  series,
+		},
+		{
+			name:          "Throttle payload then success",
+			results:       []func() (*http.Response, error){respond(http.StatusOK, throttle), respond(http.StatusOK, series)},
+			expectedCalls: 2,
+			expectedBody:  series,
+		},
+		{
+			name:          "Daily quota is not retried",
+			results:       []func() (*http.Response, error){respond(http.StatusOK, dailyLimit)},
+			expectedCalls: 1,
+			expectedBody:  dailyLimit,
+		},
+		{
+			name:          "Client errors are not retried",
+			results:       []func() (*http.Response, error){respond(http.StatusNotFound, "")},
+			expectedCalls: 1,
+			expectedBody:  "",
+		},
+		{
+			name:          "Local rate limit is not retried",
+			results:       []func() (*http.Response, error){fail(fmt.Errorf("%w: local call budget exhausted", ErrRateLimited))},
+			expectedCalls: 1,
+			expectError:   true,
+		},
+		{
+			name:          "Persistent network errors give up",
+			results:       []func() (*http.Response, error){fail(networkErr)},
+			expectedCalls: 3,
+			expectError:   true,
+		},
+		{
+			name:          "Persistent throttling returns the last response",
+			results:       []func() (*http.Response, error){respond(http.StatusOK, throttle)},
+			expectedCalls: 3,
+			expectedBody:  throttle,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := &scriptedClient{results: tt.results}
+			resp, err := newTestRetryingClient(upstream, 3).Get(context.Background(), "https://www.alphavantage.co/query")
+
+			if upstream.calls != tt.expectedCalls {
+				t.Errorf("Expected %d calls, got %d", tt.expectedCalls, upstream.calls)
+			}
+
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("Failed to read body: %v", err)
+			}
+			if string(body) != tt.expectedBody {
+				t.Errorf("Expected body %q, got %q", tt.expectedBody, string(body))
+			}
+		})
+	}
+}
+
+func TestRetryingClientBodyReadError(t *testing.T) {
+	t.Run("Read error then success", func(t *testing.T) {
+		upstream := &scriptedClient{results: []func() (*http.Response, error){truncated(os.ErrDeadlineExceeded), respond(http.StatusOK, "{}")}}
+		resp, err := newTestRetryingClient(upstream, 3).Get(context.Background(), "https://www.alphavantage.co/query")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if body, _ := io.ReadAll(resp.Body); string(body) != "{}" {
+			t.Errorf("Expected the retried body, got %q", body)
+		}
+	})
+
+	t.Run("Persistent read errors are returned", func(t *testing.T) {
+		upstream := &scriptedClient{results: []func() (*http.Response, error){truncated(os.ErrDeadlineExceeded)}}
+		resp, err := newTestRetryingClient(upstream, 3).Get(context.Background(), "https://www.alphavantage.co/query")
+		if upstream.calls != 3 {
+			t.Errorf("Expected 3 calls, got %d", upstream.calls)
+		}
+		if resp != nil {
+			t.Errorf("Expected no response, got a truncated one")
+		}
+		if !errors.Is(err, os.ErrDeadlineExceeded) || !isTimeout(err) {
+			t.Errorf("Expected the read timeout to be returned, got %v", err)
+		}
+	})
+}
+
+func TestRetryingClientBackoff(t *testing.T) {
+	client := NewRetryingClient(nil, 10, 100*time.Millisecond, time.Second, nil)
+	client.jitter = func(d time.Duration) time.Duration { return d }
+
+	expected := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+	}
+	for i, want := range expected {
+		if got := client.backoff(i + 1); got != want {
+			t.Errorf("Attempt %d: expected backoff %s, got %s", i+1, want, got)
+		}
+	}
+
+	// Full jitter never exceeds the capped delay
+	client = NewRetryingClient(nil, 10, 100*time.Millisecond, time.Second, nil)
+	for i := 0; i < 100; i++ {
+		if got := client.backoff(8); got < 0 || got >= time.Second {
+			t.Fatalf("Expected jittered backoff in [0, 1s), got %s", got)
+		}
+	}
+}
+
+func TestRetryingClientContextCancellation(t *testing.T) {
+	upstream := &scriptedClient{results: []func() (*http.Response, error){respond(http.StatusServiceUnavailable, "")}}
+	client := NewRetryingClient(upstream, 5, time.Hour, time.Hour, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	start := time.Now()
+	_, err := client.Get(ctx, "https://www.alphavantage.co/query")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("Expected cancellation to interrupt the backoff")
+	}
+	if upstream.calls != 1 {
+		t.Errorf("Expected 1 call before cancellation, got %d", upstream.calls)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ReturnsMode says whether daily returns are reported with a StockResponse
+type ReturnsMode string
+
+const (
+	// ReturnsNone reports only the raw data
+	ReturnsNone ReturnsMode = ""
+	// ReturnsInclude reports returns alongside the raw data
+	ReturnsInclude ReturnsMode = "include"
+	// ReturnsOnly reports returns instead of the raw data
+	ReturnsOnly ReturnsMode = "only"
+)
+
+const (
+	// defaultVolatilityWindow is the number of daily returns the rolling
+	// volatility covers unless the request says otherwise
+	defaultVolatilityWindow = 20
+	// maxVolatilityWindow is the longest window a request may ask for
+	maxVolatilityWindow = 252
+	// tradingDaysPerYear annualizes the daily volatility
+	tradingDaysPerYear = 252
+	// returnDecimals is the number of decimal places returns are rounded to
+	returnDecimals = 6
+)
+
+// ReturnPoint holds the returns derived from one day's close. Values that
+// need more history than the provider had are left out.
+type ReturnPoint struct {
+	Date string `json:"date"`
+	// SimpleReturn is the change from the previous close, as a fraction
+	SimpleReturn *float64 `json:"simple_return,omitempty"`
+	// LogReturn is the natural log of the close over the previous close
+	LogReturn *float64 `json:"log_return,omitempty"`
+	// Volatility is the sample standard deviation of the log returns over
+	// the volatility window ending on this day, annualized
+	Volatility *float64 `json:"volatility,omitempty"`
+}
+
+// parseReturnsMode parses a returns mode, defaulting to none when empty
+func parseReturnsMode(s string) (ReturnsMode, error) {
+	switch mode := ReturnsMode(strings.ToLower(strings.TrimSpace(s))); mode {
+	case ReturnsNone, ReturnsInclude, ReturnsOnly:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid returns mode %q: must be %q or %q", s, ReturnsInclude, ReturnsOnly)
+	}
+}
+
+// parseVolatilityWindow parses the number of daily returns the rolling
+// volatility covers
+func parseVolatilityWindow(s string) (int, error) {
+	window, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("must be a number, got %q", s)
+	}
+	if window < 2 || window > maxVolatilityWindow {
+		return 0, fmt.Errorf("must be between 2 and %d, got %d", maxVolatilityWindow, window)
+	}
+	return window, nil
+}
+
+// processReturns selects the most recent nDays trading days like
+// processTimeSeries, and derives their returns from the window days of
+// history before them so that the first day's volatility is valid. The
+// warnings cover the days dropped from all of that history, as any of them
+// can leave a return out.
+func processReturns(bars []TimeSeriesData, nDays, window int, order SortOrder) ([]TimeSeriesData, []ReturnPoint, []string, error) {
+	history, err := processTimeSeries(bars, nDays+window, OrderAscending)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	warnings := droppedDays(bars, history, nDays+window)
+
+	var dropped []string
+	for _, bar := range bars {
+		if _, err := parseTradingDate(bar.Date); err == nil && bar.Invalid {
+			dropped = append(dropped, bar.Date)
+		}
+	}
+	sort.Strings(dropped)
+
+	returns := computeReturns(history, dropped, window)
+	start := max(0, len(history)-nDays)
+	data, returns := history[start:], returns[start:]
+	if order == OrderDescending {
+		slices.Reverse(data)
+		slices.Reverse(returns)
+	}
+	return data, returns, warnings, nil
+}
+
+// computeReturns derives the returns for each of the bars, which must be
+// sorted oldest first, with volatility over window daily returns. dropped
+// holds the sorted dates of bars the provider sent that were skipped; a day
+// following one of them has no return, as it would span several sessions.
+func computeReturns(bars []TimeSeriesData, dropped []string, window int) []ReturnPoint {
+	points := make([]ReturnPoint, len(bars))
+	logReturns := nanSeries(len(bars))
+	for i, bar := range bars {
+		points[i].Date = bar.Date
+		if i == 0 || bars[i-1].ClosePrice <= 0 || droppedBetween(dropped, bars[i-1].Date, bar.Date) {
+			continue
+		}
+		ratio := float64(bar.ClosePrice) / float64(bars[i-1].ClosePrice)
+		logReturns[i] = math.Log(ratio)
+		points[i].SimpleReturn = roundedReturn(ratio - 1)
+		points[i].LogReturn = roundedReturn(logReturns[i])
+	}
+
+	for i := window; i < len(bars); i++ {
+		sample := logReturns[i-window+1 : i+1]
+		var mean float64
+		for _, value := range sample {
+			mean += value
+		}
+		mean /= float64(window)
+		if math.IsNaN(mean) {
+			continue
+		}
+
+		var variance float64
+		for _, value := range sample {
+			variance += math.Pow(value-mean, 2)
+		}
+		variance /= float64(window - 1)
+		points[i].Volatility = roundedReturn(math.Sqrt(variance * tradingDaysPerYear))
+	}
+	return points
+}
+
+// droppedBetween reports whether any of the sorted dropped dates falls
+// strictly between from and to
+func droppedBetween(dropped []string, from, to string) bool {
+	i := sort.SearchStrings(dropped, from)
+	for i < len(dropped) && dropped[i] == from {
+		i++
+	}
+	return i < len(dropped) && dropped[i] < to
+}
+
+// roundedReturn rounds a return to returnDecimals places
+func roundedReturn(value float64) *float64 {
+	scale := math.Pow10(returnDecimals)
+	rounded := math.Round(value*scale) / scale
+	return &rounded
+}
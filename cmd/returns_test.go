@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// returnsBars is four days of closes, newest first
+var returnsBars = []TimeSeriesData{
+	{Date: "2025-01-16", ClosePrice: testPrice("99")},
+	{Date: "2025-01-15", ClosePrice: testPrice("99")},
+	{Date: "2025-01-14", ClosePrice: testPrice("110")},
+	{Date: "2025-01-13", ClosePrice: testPrice("100")},
+}
+
+func TestParseReturnsMode(t *testing.T) {
+	tests := []struct {
+		input       string
+		expected    ReturnsMode
+		expectError bool
+	}{
+		{input: "", expected: ReturnsNone},
+		{input: "include", expected: ReturnsInclude},
+		{input: " ONLY ", expected: ReturnsOnly},
+		{input: "true", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			mode, err := parseReturnsMode(tt.input)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error, got %q", mode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if mode != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, mode)
+			}
+		})
+	}
+}
+
+func TestParseVolatilityWindow(t *testing.T) {
+	tests := []struct {
+		input       string
+		expected    int
+		expectError bool
+	}{
+		{input: "2", expected: 2},
+		{input: " 252 ", expected: 252},
+		{input: "1", expectError: true},
+		{input: "253", expectError: true},
+		{input: "month", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			window, err := parseVolatilityWindow(tt.input)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error, got %d", window)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if window != tt.expected {
+				t.Errorf("Expected %d, got %d", tt.expected, window)
+			}
+		})
+	}
+}
+
+func TestComputeReturns(t *testing.T) {
+	value := func(f float64) *float64 { return &f }
+	bars := []TimeSeriesData{returnsBars[3], returnsBars[2], returnsBars[1], returnsBars[0]}
+
+	expected := []ReturnPoint{
+		{Date: "2025-01-13"},
+		{Date: "2025-01-14", SimpleReturn: value(0.1), LogReturn: value(0.09531)},
+		{Date: "2025-01-15", SimpleReturn: value(-0.1), LogReturn: value(-0.105361), Volatility: value(2.252523)},
+		{Date: "2025-01-16", SimpleReturn: value(0), LogReturn: value(0), Volatility: value(1.182669)},
+	}
+
+	returns := computeReturns(bars, nil, 2)
+	if !reflect.DeepEqual(returns, expected) {
+		got, _ := json.Marshal(returns)
+		want, _ := json.Marshal(expected)
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+func TestProcessReturns(t *testing.T) {
+	data, returns, _, err := processReturns(returnsBars, 2, 2, OrderDescending)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(data) != 2 || len(returns) != 2 {
+		t.Fatalf("Expected 2 days of data and returns, got %d and %d", len(data), len(returns))
+	}
+	for i, date := range []string{"2025-01-16", "2025-01-15"} {
+		if data[i].Date != date || returns[i].Date != date {
+			t.Errorf("Expected day %d to be %s, got %s and %s", i, date, data[i].Date, returns[i].Date)
+		}
+		if returns[i].Volatility == nil {
+			t.Errorf("Expected volatility on %s after warming up", date)
+		}
+	}
+}
+
+func TestProcessReturnsDroppedDay(t *testing.T) {
+	dropped := TimeSeriesData{Date: "2025-01-13"}
+	dropped.invalidate("missing close")
+	bars := []TimeSeriesData{
+		{Date: "2025-01-15", ClosePrice: testPrice("21")},
+		{Date: "2025-01-14", ClosePrice: testPrice("20")},
+		dropped,
+		{Date: "2025-01-10", ClosePrice: testPrice("10")},
+		{Date: "2025-01-09", ClosePrice: testPrice("9")},
+	}
+
+	_, returns, warnings, err := processReturns(bars, 2, 2, OrderDescending)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	value := func(f float64) *float64 { return &f }
+	expected := []ReturnPoint{
+		{Date: "2025-01-15", SimpleReturn: value(0.05), LogReturn: value(0.04879)},
+		{Date: "2025-01-14"},
+	}
+	if !reflect.DeepEqual(returns, expected) {
+		got, _ := json.Marshal(returns)
+		want, _ := json.Marshal(expected)
+		t.Errorf("Expected no returns across the dropped day, expected %s, got %s", want, got)
+	}
+
+	expectedWarnings := []string{"2025-01-13 dropped: missing close"}
+	if !reflect.DeepEqual(warnings, expectedWarnings) {
+		t.Errorf("Expected warnings %q for the warm-up history, got %q", expectedWarnings, warnings)
+	}
+}
+
+func TestCreateHandlerReturns(t *testing.T) {
+	config := &Config{Symbol: "AAPL", NDays: 2, Order: OrderDescending, MaxDays: 100}
+	var gotDays int
+	provider := &MockProvider{
+		DailyBarsFunc: func(ctx context.Context, symbol string, nDays int) ([]TimeSeriesData, error) {
+			gotDays = nDays
+			return returnsBars, nil
+		},
+	}
+	handler := createHandler(config, provider)
+
+	tests := []struct {
+		name         string
+		target       string
+		expectedDays int
+		expected     string
+		absent       string
+	}{
+		{"Returns are opt-in", "/", 2, `"data":[`, `"returns"`},
+		{"Returns alongside the data", "/?returns=include&volatility_window=2", 4, `"returns":[{"date":"2025-01-16","simple_return":0,"log_return":0,"volatility":1.182669}`, ""},
+		{"Returns instead of the data", "/?returns=only&volatility_window=2&days=1", 3, `"returns":[{"date":"2025-01-16"`, `"data"`},
+		{"Default volatility window", "/?returns=only", 22, `"average_close":99,`, `"data"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			body := recorder.Body.String()
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, recorder.Code, body)
+			}
+			if gotDays != tt.expectedDays {
+				t.Errorf("Expected %d days requested from the provider, got %d", tt.expectedDays, gotDays)
+			}
+			if !strings.Contains(body, tt.expected) {
+				t.Errorf("Expected %s in the response, got %s", tt.expected, body)
+			}
+			if tt.absent != "" && strings.Contains(body, tt.absent) {
+				t.Errorf("Expected no %s in the response, got %s", tt.absent, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"log/slog"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// redactedValue replaces secrets in log output, errors and printed config
+const redactedValue = "[REDACTED]"
+
+// defaultSecretRefresh is how often secrets read from files are re-read
+// unless SECRET_REFRESH_INTERVAL says otherwise
+const defaultSecretRefresh = time.Minute
+
+// secretParamPattern matches credentials passed as query parameters
+var secretParamPattern = regexp.MustCompile(`(?i)\b((?:api_?key|token)=)[^&\s"']+`)
+
+// Secret is a credential such as the provider API key. It prints, marshals
+// and logs as [REDACTED]; Reveal returns the value for the places that have
+// to send it.
+type Secret string
+
+// Reveal returns the secret value
+func (s Secret) Reveal() string {
+	return string(s)
+}
+
+// String implements the fmt.Stringer interface
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redactedValue
+}
+
+// GoString implements the fmt.GoStringer interface, covering %#v
+func (s Secret) GoString() string {
+	return `"` + s.String() + `"`
+}
+
+// MarshalText implements the encoding.TextMarshaler interface
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// LogValue implements the slog.LogValuer interface
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(s.String())
+}
+
+// newRedactor returns a function that removes secrets and credential query
+// parameters from a string. Secrets are also matched in their URL encoded
+// form, as that is how they appear in request URLs.
+func newRedactor(secrets []string) func(string) string {
+	var forms []string
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+		forms = append(forms, secret)
+		if escaped := url.QueryEscape(secret); escaped != secret {
+			forms = append(forms, escaped)
+		}
+	}
+
+	return func(s string) string {
+		for _, form := range forms {
+			s = strings.ReplaceAll(s, form, redactedValue)
+		}
+		return secretParamPattern.ReplaceAllString(s, "${1}"+redactedValue)
+	}
+}
+
+// redactedError is an error whose text has had secrets removed. The
+// original error stays reachable for errors.Is and errors.As.
+type redactedError struct {
+	err error
+	msg string
+}
+
+// Error implements the error interface
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+// Unwrap returns the original error
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// redactError returns err with redact applied to its text, or err itself
+// when there is nothing to redact
+func redactError(err error, redact func(string) string) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	if redacted := redact(msg); redacted != msg {
+		return &redactedError{err: err, msg: redacted}
+	}
+	return err
+}
+
+// SecretFile is a secret read from a file, such as a mounted Kubernetes
+// secret. The file is re-read at most once per Refresh when the secret is
+// used, so a rotated secret is picked up without a restart. If the file
+// cannot be read the previous value is kept.
+type SecretFile struct {
+	Path    string
+	Refresh time.Duration
+
+	now     func() time.Time
+	mu      sync.Mutex
+	value   Secret
+	checked time.Time
+}
+
+// NewSecretFile returns a SecretFile for path holding value, which the
+// caller has just read from it
+func NewSecretFile(path string, value Secret, refresh time.Duration) *SecretFile {
+	return &SecretFile{Path: path, Refresh: refresh, now: time.Now, value: value, checked: time.Now()}
+}
+
+// Secret returns the current secret, re-reading the file if it is due
+func (f *SecretFile) Secret() Secret {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.now()
+	if f.Refresh > 0 && now.Sub(f.checked) >= f.Refresh {
+		f.checked = now
+		f.reloadLocked()
+	}
+	return f.value
+}
+
+// reloadLocked re-reads the file. f.mu must be held.
+func (f *SecretFile) reloadLocked() {
+	value, err := readSettingFile(f.Path)
+	switch {
+	case err != nil:
+		slog.Warn("Error re-reading secret file, keeping the current value", "path", f.Path, "error", err)
+	case value == "":
+		slog.Warn("Secret file is empty, keeping the current value", "path", f.Path)
+	case Secret(value) != f.value:
+		f.value = Secret(value)
+		slog.Info("Secret file changed, using the new value", "path", f.Path)
+	}
+}
+
+// warnIfExposed logs a warning when a secret file can be read by users
+// other than its owner and group
+func warnIfExposed(path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	if mode := info.Mode().Perm(); mode&0o007 != 0 {
+		slog.Warn("Secret file is accessible to other users, restrict it to 0400 or 0440", "path", path, "mode", mode.String())
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testSecret needs URL encoding so both of its forms are checked
+const testSecret = "k3y/with+special=chars"
+
+// assertNoSecret fails the test if output contains the secret in any form
+func assertNoSecret(t *testing.T, where, output string) {
+	t.Helper()
+	for _, form := range []string{testSecret, url.QueryEscape(testSecret)} {
+		if strings.Contains(output, form) {
+			t.Errorf("Expected the API key to be redacted from %s, got %s", where, output)
+		}
+	}
+}
+
+func TestSecretFormatting(t *testing.T) {
+	config := &Config{Symbol: "AAPL", NDays: 5, APIKey: testSecret}
+
+	var logs bytes.Buffer
+	slog.New(slog.NewTextHandler(&logs, nil)).Info("config", "config", config, "key", config.APIKey)
+	encoded, err := json.Marshal(config)
+	if err != nil {
+		t.Fatalf("Failed to marshal config: %v", err)
+	}
+
+	outputs := map[string]string{
+		"%v":       fmt.Sprintf("%v", config),
+		"%+v":      fmt.Sprintf("%+v", *config),
+		"%#v":      fmt.Sprintf("%#v", *config),
+		"%s":       fmt.Sprintf("%s", config.APIKey),
+		"%q":       fmt.Sprintf("%q", config.APIKey),
+		"JSON":     string(encoded),
+		"slog":     logs.String(),
+		"String()": config.APIKey.String(),
+	}
+	for where, output := range outputs {
+		assertNoSecret(t, where, output)
+	}
+
+	if config.APIKey.Reveal() != testSecret {
+		t.Errorf("Expected Reveal to return the key, got %q", config.APIKey.Reveal())
+	}
+	if Secret("").String() != "" {
+		t.Error("Expected an empty secret to print as empty")
+	}
+}
+
+func TestNewRedactor(t *testing.T) {
+	redact := newRedactor([]string{"", testSecret})
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"key " + testSecret, "key " + redactedValue},
+		{"https://host/query?apikey=" + url.QueryEscape(testSecret) + "&symbol=IBM", "https://host/query?apikey=" + redactedValue + "&symbol=IBM"},
+		{`Get "https://host/query?APIKEY=other"`, `Get "https://host/query?APIKEY=` + redactedValue + `"`},
+		{"https://host/query?api_key=other&token=abc", "https://host/query?api_key=" + redactedValue + "&token=" + redactedValue},
+		{"nothing to hide", "nothing to hide"},
+	}
+
+	for _, tt := range tests {
+		if got := redact(tt.input); got != tt.expected {
+			t.Errorf("redact(%q) = %q, expected %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestRedactErrorKeepsChain(t *testing.T) {
+	redact := newRedactor([]string{testSecret})
+	original := &url.Error{Op: "Get", URL: "https://host/query?apikey=" + url.QueryEscape(testSecret), Err: context.DeadlineExceeded}
+	err := redactError(fmt.Errorf("retry aborted after 2 attempts: %w", original), redact)
+
+	assertNoSecret(t, "the error", err.Error())
+	if !errors.Is(err, context.DeadlineExceeded) || !isTimeout(err) {
+		t.Errorf("Expected the redacted error to still be a timeout, got %v", err)
+	}
+
+	plain := errors.New("no secrets here")
+	if redactError(plain, redact) != plain {
+		t.Error("Expected errors without secrets to be returned unchanged")
+	}
+	if redactError(nil, redact) != nil {
+		t.Error("Expected nil to stay nil")
+	}
+}
+
+// TestAPIKeyNeverExposed drives failing upstream calls through the same
+// client and provider stack as main and checks every output for the key
+func TestAPIKeyNeverExposed(t *testing.T) {
+	logs := captureLogs(t, testSecret)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("symbol") {
+		case "DOWN":
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				conn.Close()
+			}
+		case "SLOW":
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+		case "BOOM":
+			http.Error(w, "internal error for "+r.URL.String(), http.StatusInternalServerError)
+		case "ECHO":
+			fmt.Fprintf(w, `{"Error Message": "Invalid API key %s"}`, r.URL.Query().Get("apikey"))
+		default:
+			io.WriteString(w, `{"Time Series (Daily)": {"2025-01-15": {"4. close": "100.00"}}}`)
+		}
+	}))
+	defer upstream.Close()
+
+	config := &Config{
+		Symbol: "AAPL", NDays: 5, Order: OrderDescending, MaxDays: 100, BatchWorkers: 2,
+		APIKey: testSecret, RequestTimeout: 5 * time.Second,
+	}
+	limiter := NewRateLimiter(RateLimits{}, RateLimitQueue, 0)
+	client := NewRetryingClient(
+		&RateLimitedClient{Client: &DefaultHTTPClient{Timeout: 50 * time.Millisecond}, Limiter: limiter},
+		2, time.Millisecond, time.Millisecond, alphaVantageThrottled,
+	)
+	monitor := &UpstreamMonitor{}
+	metrics := NewMetrics()
+	provider := Provider(&AlphaVantageProvider{APIKey: config.APIKey, BaseURL: upstream.URL, Client: client})
+	provider = &monitoredProvider{Provider: provider, Monitor: monitor, Metrics: metrics}
+	cache := NewCachingProvider(provider, time.Minute, 0, time.Hour)
+	cache.Metrics = metrics
+	server := newServer(context.Background(), config, cache, limiter, monitor, metrics)
+
+	tests := []struct {
+		target         string
+		expectedStatus int
+	}{
+		{"/?symbol=DOWN", http.StatusInternalServerError},
+		{"/?symbol=SLOW", http.StatusGatewayTimeout},
+		{"/?symbol=BOOM", http.StatusInternalServerError},
+		{"/?symbol=ECHO", http.StatusBadGateway},
+		{"/v1/quotes?symbols=DOWN,BOOM,ECHO,IBM", http.StatusOK},
+		{"/v1/status", http.StatusOK},
+		{"/readyz", http.StatusOK},
+		{"/healthz", http.StatusOK},
+		{"/metrics", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		recorder := httptest.NewRecorder()
+		server.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+		if recorder.Code != tt.expectedStatus {
+			t.Errorf("%s: expected status code %d, got %d", tt.target, tt.expectedStatus, recorder.Code)
+		}
+		assertNoSecret(t, tt.target+" response", recorder.Body.String())
+		assertNoSecret(t, tt.target+" headers", fmt.Sprint(recorder.Header()))
+	}
+
+	if !strings.Contains(logs.String(), "Upstream error") {
+		t.Fatalf("Expected upstream errors to be logged, got %s", logs.String())
+	}
+	assertNoSecret(t, "logs", logs.String())
+
+	_, err := provider.DailyBars(context.Background(), "DOWN", 5)
+	if err == nil {
+		t.Fatal("Expected an error for a dropped connection")
+	}
+	assertNoSecret(t, "provider errors", err.Error())
+}
+
+func TestSecretFileRotation(t *testing.T) {
+	logs := captureLogs(t)
+	path := filepath.Join(t.TempDir(), "apikey")
+	writeFile := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o400); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile("old-key\n")
+
+	now := time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)
+	file := NewSecretFile(path, "old-key", time.Minute)
+	file.now = func() time.Time { return now }
+	file.checked = now
+
+	// Remove and recreate the file as a secret volume update would
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	writeFile("new-key\n")
+
+	steps := []struct {
+		name     string
+		advance  time.Duration
+		setup    func()
+		expected Secret
+	}{
+		{name: "Before the refresh interval", advance: 30 * time.Second, expected: "old-key"},
+		{name: "After the refresh interval", advance: 30 * time.Second, expected: "new-key"},
+		{name: "File removed", advance: time.Minute, setup: func() { os.Remove(path) }, expected: "new-key"},
+		{name: "File emptied", advance: time.Minute, setup: func() { writeFile("\n") }, expected: "new-key"},
+		{name: "File restored", advance: time.Minute, setup: func() { os.Remove(path); writeFile("newest-key") }, expected: "newest-key"},
+	}
+
+	for _, step := range steps {
+		now = now.Add(step.advance)
+		if step.setup != nil {
+			step.setup()
+		}
+		if got := file.Secret(); got != step.expected {
+			t.Errorf("%s: expected %q, got %q", step.name, step.expected.Reveal(), got.Reveal())
+		}
+	}
+
+	for _, key := range []string{"old-key", "new-key", "newest-key"} {
+		if strings.Contains(logs.String(), key) {
+			t.Errorf("Expected secret values to stay out of the logs, got %s", logs.String())
+		}
+	}
+	if !strings.Contains(logs.String(), "Secret file changed") || !strings.Contains(logs.String(), "keeping the current value") {
+		t.Errorf("Expected rotation and read failures to be logged, got %s", logs.String())
+	}
+}
+
+func TestSecretFileRefreshDisabled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "apikey")
+	if err := os.WriteFile(path, []byte("new-key"), 0o400); err != nil {
+		t.Fatal(err)
+	}
+
+	file := NewSecretFile(path, "old-key", 0)
+	file.now = func() time.Time { return time.Now().Add(time.Hour) }
+	if got := file.Secret(); got != "old-key" {
+		t.Errorf("Expected the file not to be re-read, got %q", got.Reveal())
+	}
+}
+
+func TestWarnIfExposed(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		mode     os.FileMode
+		expected bool
+	}{
+		{0o400, false},
+		{0o440, false},
+		{0o644, true},
+		{0o606, true},
+	}
+
+	for _, tt := range tests {
+		logs := captureLogs(t)
+		path := filepath.Join(dir, tt.mode.String())
+		if err := os.WriteFile(path, []byte("key"), tt.mode); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(path, tt.mode); err != nil {
+			t.Fatal(err)
+		}
+
+		warnIfExposed(path)
+		if warned := strings.Contains(logs.String(), "accessible to other users"); warned != tt.expected {
+			t.Errorf("Mode %s: expected warning %v, got %s", tt.mode, tt.expected, logs.String())
+		}
+	}
+}
+
+func TestAlphaVantageProviderKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "apikey")
+	if err := os.WriteFile(path, []byte("rotated-key"), 0o400); err != nil {
+		t.Fatal(err)
+	}
+
+	var requested string
+	client := &MockHTTPClient{
+		DoFunc: func(ctx context.Context, url string) (*http.Response, error) {
+			requested = url
+			return nil, fmt.Errorf("Get %q: connection refused", url)
+		},
+	}
+	config := &Config{APIKey: "original-key", APIKeyFile: path, SecretRefresh: time.Minute}
+	provider := newAlphaVantageProvider(config, client).(*AlphaVantageProvider)
+	provider.KeyFile.now = func() time.Time { return time.Now().Add(time.Minute) }
+
+	_, err := provider.DailyBars(context.Background(), "IBM", 5)
+	if !strings.Contains(requested, "apikey=rotated-key") {
+		t.Errorf("Expected the rotated key to be sent, got %q", requested)
+	}
+	if err == nil || strings.Contains(err.Error(), "rotated-key") {
+		t.Errorf("Expected the rotated key to be redacted from errors, got %v", err)
+	}
+}
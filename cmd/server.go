@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	// defaultListenAddr is the address the server listens on unless
+	// LISTEN_ADDR says otherwise
+	defaultListenAddr = ":8080"
+	// defaultReadTimeout bounds reading a request unless SERVER_READ_TIMEOUT
+	// says otherwise
+	defaultReadTimeout = 10 * time.Second
+	// defaultWriteTimeout bounds handling and writing a response unless
+	// SERVER_WRITE_TIMEOUT says otherwise. It is longer than the default
+	// REQUEST_TIMEOUT so timed out requests still get their 504.
+	defaultWriteTimeout = 40 * time.Second
+	// defaultIdleTimeout is how long a keep-alive connection may sit idle
+	// unless SERVER_IDLE_TIMEOUT says otherwise
+	defaultIdleTimeout = 60 * time.Second
+	// defaultShutdownTimeout is how long in-flight requests may take to
+	// drain on shutdown unless SHUTDOWN_TIMEOUT says otherwise
+	defaultShutdownTimeout = 20 * time.Second
+)
+
+// newServer returns the HTTP server for the API. Only the data endpoints
+// call the upstream; unknown paths and the probes never do. The readiness
+// probe fails once ctx is cancelled.
+func newServer(ctx context.Context, config *Config, provider Provider, limiter *RateLimiter, monitor *UpstreamMonitor, metrics *Metrics) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/{$}", createHandler(config, provider))
+	mux.HandleFunc("/v1/quotes", createQuotesHandler(config, provider))
+	mux.HandleFunc("/v1/indicators/{symbol}", createIndicatorsHandler(config, provider))
+	mux.HandleFunc("/v1/status", createStatusHandler(provider, limiter))
+	mux.HandleFunc("/healthz", createHealthHandler())
+	mux.HandleFunc("/readyz", createReadyHandler(ctx, provider, limiter, monitor))
+	mux.HandleFunc("/metrics", createMetricsHandler(metrics, limiter))
+	mux.HandleFunc("/", writeNotFound)
+
+	return &http.Server{
+		Addr:              config.ListenAddr,
+		Handler:           instrumentHandler(metrics, mux),
+		ReadHeaderTimeout: config.ReadTimeout,
+		ReadTimeout:       config.ReadTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+	}
+}
+
+// startServer serves the API until ctx is cancelled, then drains in-flight
+// requests before returning
+func startServer(ctx context.Context, config *Config, provider Provider, limiter *RateLimiter, monitor *UpstreamMonitor, metrics *Metrics) error {
+	server := newServer(ctx, config, provider, limiter, monitor, metrics)
+
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Starting server", "addr", listener.Addr().String(), "symbol", config.Symbol, "days", config.NDays, "provider", provider.Name())
+	return serve(ctx, server, listener, config.ShutdownDelay, config.ShutdownTimeout)
+}
+
+// serve runs server on listener until ctx is cancelled. It then keeps
+// serving for delay, giving load balancers time to stop routing new
+// requests here, and waits up to timeout for in-flight requests to finish.
+func serve(ctx context.Context, server *http.Server, listener net.Listener, delay, timeout time.Duration) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	if delay > 0 {
+		slog.Info("Shutdown requested, delaying drain", "delay", delay.String())
+		time.Sleep(delay)
+	}
+
+	slog.Info("Shutting down, draining in-flight requests", "timeout", timeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("error draining in-flight requests: %w", err)
+	}
+
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	slog.Info("Server stopped")
+	return nil
+}
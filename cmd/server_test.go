@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewServer(t *testing.T) {
+	config := &Config{
+		Symbol:       "AAPL",
+		NDays:        5,
+		Order:        OrderDescending,
+		MaxDays:      100,
+		ListenAddr:   ":9090",
+		ReadTimeout:  time.Second,
+		WriteTimeout: 2 * time.Second,
+		IdleTimeout:  3 * time.Second,
+	}
+	limiter := NewRateLimiter(RateLimits{}, RateLimitQueue, 0)
+	server := newServer(context.Background(), config, &MockProvider{}, limiter, &UpstreamMonitor{}, NewMetrics())
+
+	if server.Addr != ":9090" || server.ReadTimeout != time.Second || server.ReadHeaderTimeout != time.Second ||
+		server.WriteTimeout != 2*time.Second || server.IdleTimeout != 3*time.Second {
+		t.Errorf("Expected server settings from the config, got addr=%s read=%s write=%s idle=%s",
+			server.Addr, server.ReadTimeout, server.WriteTimeout, server.IdleTimeout)
+	}
+
+	for _, path := range []string{"/v1/status", "/healthz", "/readyz"} {
+		recorder := httptest.NewRecorder()
+		server.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		if recorder.Code != http.StatusOK {
+			t.Errorf("Expected %s to be routed, got status %d", path, recorder.Code)
+		}
+	}
+
+	// Unknown paths get a JSON 404 rather than reaching the stock handler
+	recorder := httptest.NewRecorder()
+	server.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/favicon.ico", nil))
+	var response ErrorResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode error response: %v", err)
+	}
+	if recorder.Code != http.StatusNotFound || response.Error.Code != errorCodeNotFound {
+		t.Errorf("Expected a %s error with status 404, got %d %+v", errorCodeNotFound, recorder.Code, response.Error)
+	}
+}
+
+// startTestServer serves handler on a random local port until ctx is
+// cancelled, returning the base URL and the result of serve
+func startTestServer(t *testing.T, ctx context.Context, handler http.Handler, timeout time.Duration) (string, <-chan error) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		result <- serve(ctx, &http.Server{Handler: handler}, listener, 0, timeout)
+	}()
+	return "http://" + listener.Addr().String(), result
+}
+
+func TestServeDrainsInFlightRequests(t *testing.T) {
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		_, _ = io.WriteString(w, "done")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	url, result := startTestServer(t, ctx, handler, 5*time.Second)
+
+	type response struct {
+		status int
+		body   string
+		err    error
+	}
+	responses := make(chan response, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			responses <- response{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		responses <- response{status: resp.StatusCode, body: string(body), err: err}
+	}()
+
+	<-started
+	cancel()
+
+	got := <-responses
+	if got.err != nil || got.status != http.StatusOK || got.body != "done" {
+		t.Errorf("Expected the in-flight request to complete, got status=%d body=%q err=%v", got.status, got.body, got.err)
+	}
+	if err := <-result; err != nil {
+		t.Errorf("Expected a clean shutdown, got %v", err)
+	}
+
+	if _, err := http.Get(url); err == nil {
+		t.Error("Expected new connections to be refused after shutdown")
+	}
+}
+
+func TestServeShutdownTimeout(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	url, result := startTestServer(t, ctx, handler, 20*time.Millisecond)
+
+	go func() {
+		if resp, err := http.Get(url); err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	<-started
+	cancel()
+
+	if err := <-result; err == nil {
+		t.Error("Expected an error when in-flight requests outlive the shutdown timeout")
+	}
+}
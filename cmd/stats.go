@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// Names of the statistics a request can select with the stats parameter.
+// Each matches its field in Stats.
+const (
+	statMinClose      = "min_close"
+	statMaxClose      = "max_close"
+	statMedianClose   = "median_close"
+	statStdDevClose   = "stddev_close"
+	statVWAP          = "vwap"
+	statTotalVolume   = "total_volume"
+	statChangePercent = "change_percent"
+	statAverageRange  = "average_range"
+	// statAll selects every statistic
+	statAll = "all"
+)
+
+// statNames lists the selectable statistics in the order they are reported
+var statNames = []string{
+	statMinClose, statMaxClose, statMedianClose, statStdDevClose,
+	statVWAP, statTotalVolume, statChangePercent, statAverageRange,
+}
+
+// Stats holds aggregate statistics over the days in a StockResponse. Only
+// the selected statistics are set.
+type Stats struct {
+	// MinClose and MaxClose report the most recent day when closes tie
+	MinClose    *DatedPrice `json:"min_close,omitempty"`
+	MaxClose    *DatedPrice `json:"max_close,omitempty"`
+	MedianClose *Price      `json:"median_close,omitempty"`
+	// StdDevClose is the population standard deviation of the close
+	StdDevClose *Price `json:"stddev_close,omitempty"`
+	// VWAP is the volume weighted average of each day's typical price,
+	// (high + low + close) / 3. It is left out when there was no volume.
+	VWAP        *Price `json:"vwap,omitempty"`
+	TotalVolume *int64 `json:"total_volume,omitempty"`
+	// ChangePercent is the change from the oldest close to the newest, in
+	// percent rounded to two places
+	ChangePercent *float64 `json:"change_percent,omitempty"`
+	// AverageRange is the mean of each day's high minus its low
+	AverageRange *Price `json:"average_range,omitempty"`
+}
+
+// DatedPrice is a close price and the day it was seen
+type DatedPrice struct {
+	Date  string `json:"date"`
+	Close Price  `json:"close"`
+}
+
+// statSet is the set of statistics selected by a request
+type statSet map[string]bool
+
+// parseStats parses a comma separated list of statistic names, or "all"
+func parseStats(s string) (statSet, error) {
+	stats := make(statSet)
+	for _, part := range strings.Split(s, ",") {
+		name := strings.ToLower(strings.TrimSpace(part))
+		switch {
+		case name == "":
+			continue
+		case name == statAll:
+			for _, name := range statNames {
+				stats[name] = true
+			}
+		case isStatName(name):
+			stats[name] = true
+		default:
+			return nil, fmt.Errorf("unknown statistic %q: must be %s or %s", part, strings.Join(statNames, ", "), statAll)
+		}
+	}
+	return stats, nil
+}
+
+// isStatName reports whether name is a selectable statistic
+func isStatName(name string) bool {
+	for _, stat := range statNames {
+		if stat == name {
+			return true
+		}
+	}
+	return false
+}
+
+// computeStats returns the selected statistics over data, with computed
+// prices rounded as r says, or nil when none are selected or data is empty
+func computeStats(data []TimeSeriesData, selected statSet, r Rounding) *Stats {
+	if len(selected) == 0 || len(data) == 0 {
+		return nil
+	}
+
+	stats := &Stats{}
+	n := int64(len(data))
+
+	if selected[statMinClose] || selected[statMaxClose] {
+		// Ties go to the most recent day, whatever the order of data
+		low, high := data[0], data[0]
+		for _, bar := range data[1:] {
+			if bar.ClosePrice < low.ClosePrice || bar.ClosePrice == low.ClosePrice && bar.Date > low.Date {
+				low = bar
+			}
+			if bar.ClosePrice > high.ClosePrice || bar.ClosePrice == high.ClosePrice && bar.Date > high.Date {
+				high = bar
+			}
+		}
+		if selected[statMinClose] {
+			stats.MinClose = &DatedPrice{Date: low.Date, Close: low.ClosePrice}
+		}
+		if selected[statMaxClose] {
+			stats.MaxClose = &DatedPrice{Date: high.Date, Close: high.ClosePrice}
+		}
+	}
+
+	if selected[statMedianClose] {
+		closes := make([]Price, len(data))
+		for i, bar := range data {
+			closes[i] = bar.ClosePrice
+		}
+		sort.Slice(closes, func(i, j int) bool { return closes[i] < closes[j] })
+
+		median := closes[len(closes)/2]
+		if len(closes)%2 == 0 {
+			median = (closes[len(closes)/2-1] + median).Div(2, r)
+		}
+		stats.MedianClose = &median
+	}
+
+	if selected[statStdDevClose] {
+		var mean float64
+		for _, bar := range data {
+			mean += float64(bar.ClosePrice)
+		}
+		mean /= float64(n)
+
+		var variance float64
+		for _, bar := range data {
+			variance += math.Pow(float64(bar.ClosePrice)-mean, 2)
+		}
+		stdDev := priceFromFloat(math.Sqrt(variance/float64(n))/priceScale, r)
+		stats.StdDevClose = &stdDev
+	}
+
+	if selected[statVWAP] || selected[statTotalVolume] {
+		weighted, volume := new(big.Int), new(big.Int)
+		for _, bar := range data {
+			typical := big.NewInt(int64(bar.HighPrice + bar.LowPrice + bar.ClosePrice))
+			weighted.Add(weighted, typical.Mul(typical, big.NewInt(bar.Volume)))
+			volume.Add(volume, big.NewInt(bar.Volume))
+		}
+		if selected[statVWAP] && volume.Sign() > 0 {
+			vwap := divRound(weighted, new(big.Int).Mul(volume, big.NewInt(3)), r)
+			stats.VWAP = &vwap
+		}
+		if selected[statTotalVolume] {
+			total := volume.Int64()
+			stats.TotalVolume = &total
+		}
+	}
+
+	if selected[statChangePercent] {
+		oldest, newest := data[0], data[len(data)-1]
+		if oldest.Date > newest.Date {
+			oldest, newest = newest, oldest
+		}
+		if oldest.ClosePrice != 0 {
+			change := float64(newest.ClosePrice-oldest.ClosePrice) / float64(oldest.ClosePrice) * 100
+			change = math.Round(change*100) / 100
+			stats.ChangePercent = &change
+		}
+	}
+
+	if selected[statAverageRange] {
+		var total Price
+		for _, bar := range data {
+			total += bar.HighPrice - bar.LowPrice
+		}
+		averageRange := total.Div(n, r)
+		stats.AverageRange = &averageRange
+	}
+
+	return stats
+}
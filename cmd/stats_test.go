@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// statsBars is a four day window with round numbers, newest first
+var statsBars = []TimeSeriesData{
+	{Date: "2025-01-16", HighPrice: testPrice("100"), LowPrice: testPrice("96"), ClosePrice: testPrice("98"), Volume: 2000},
+	{Date: "2025-01-15", HighPrice: testPrice("104"), LowPrice: testPrice("100"), ClosePrice: testPrice("102"), Volume: 2000},
+	{Date: "2025-01-14", HighPrice: testPrice("106"), LowPrice: testPrice("100"), ClosePrice: testPrice("104"), Volume: 3000},
+	{Date: "2025-01-13", HighPrice: testPrice("102"), LowPrice: testPrice("98"), ClosePrice: testPrice("100"), Volume: 1000},
+}
+
+func TestParseStats(t *testing.T) {
+	tests := []struct {
+		input       string
+		expected    statSet
+		expectError bool
+	}{
+		{input: "vwap", expected: statSet{statVWAP: true}},
+		{input: " Min_Close, max_close,", expected: statSet{statMinClose: true, statMaxClose: true}},
+		{input: "all", expected: statSet{
+			statMinClose: true, statMaxClose: true, statMedianClose: true, statStdDevClose: true,
+			statVWAP: true, statTotalVolume: true, statChangePercent: true, statAverageRange: true,
+		}},
+		{input: "vwap,mean", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			stats, err := parseStats(tt.input)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error, got %v", stats)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(stats, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, stats)
+			}
+		})
+	}
+}
+
+func TestComputeStats(t *testing.T) {
+	all, _ := parseStats(statAll)
+	price := func(s string) *Price {
+		p := testPrice(s)
+		return &p
+	}
+	totalVolume := int64(8000)
+	change, shortChange := -2.0, -5.77
+
+	tests := []struct {
+		name     string
+		data     []TimeSeriesData
+		selected statSet
+		rounding Rounding
+		expected *Stats
+	}{
+		{
+			name:     "Every statistic",
+			data:     statsBars,
+			selected: all,
+			expected: &Stats{
+				MinClose:      &DatedPrice{Date: "2025-01-16", Close: testPrice("98")},
+				MaxClose:      &DatedPrice{Date: "2025-01-14", Close: testPrice("104")},
+				MedianClose:   price("101"),
+				StdDevClose:   price("2.2361"),
+				VWAP:          price("101.25"),
+				TotalVolume:   &totalVolume,
+				ChangePercent: &change,
+				AverageRange:  price("4.5"),
+			},
+		},
+		{
+			name:     "Selected statistics are rounded",
+			data:     statsBars,
+			selected: statSet{statStdDevClose: true, statVWAP: true},
+			rounding: Rounding{Mode: RoundHalfEven, Decimals: 1},
+			expected: &Stats{StdDevClose: price("2.2"), VWAP: price("101.2")},
+		},
+		{
+			name:     "Odd number of days",
+			data:     statsBars[:3],
+			selected: statSet{statMedianClose: true, statChangePercent: true},
+			expected: &Stats{MedianClose: price("102"), ChangePercent: &shortChange},
+		},
+		{
+			name:     "No volume leaves out the VWAP",
+			data:     []TimeSeriesData{{Date: "2025-01-15", ClosePrice: testPrice("100")}},
+			selected: statSet{statVWAP: true},
+			expected: &Stats{},
+		},
+		{
+			name:     "Nothing selected",
+			data:     statsBars,
+			selected: nil,
+			expected: nil,
+		},
+		{
+			name:     "No data",
+			data:     nil,
+			selected: all,
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats := computeStats(tt.data, tt.selected, tt.rounding)
+			if !reflect.DeepEqual(stats, tt.expected) {
+				got, _ := json.Marshal(stats)
+				expected, _ := json.Marshal(tt.expected)
+				t.Errorf("Expected %s, got %s", expected, got)
+			}
+		})
+	}
+}
+
+func TestComputeStatsTiesGoToTheMostRecentDay(t *testing.T) {
+	ascending := []TimeSeriesData{
+		{Date: "2025-01-10", ClosePrice: testPrice("10")},
+		{Date: "2025-01-13", ClosePrice: testPrice("12")},
+		{Date: "2025-01-14", ClosePrice: testPrice("10")},
+		{Date: "2025-01-15", ClosePrice: testPrice("12")},
+	}
+	descending := []TimeSeriesData{ascending[3], ascending[2], ascending[1], ascending[0]}
+	selected := statSet{statMinClose: true, statMaxClose: true}
+
+	for name, data := range map[string][]TimeSeriesData{"asc": ascending, "desc": descending} {
+		t.Run(name, func(t *testing.T) {
+			stats := computeStats(data, selected, Rounding{})
+			if stats.MinClose.Date != "2025-01-14" {
+				t.Errorf("Expected min_close on 2025-01-14, got %s", stats.MinClose.Date)
+			}
+			if stats.MaxClose.Date != "2025-01-15" {
+				t.Errorf("Expected max_close on 2025-01-15, got %s", stats.MaxClose.Date)
+			}
+		})
+	}
+}
+
+func TestCreateHandlerStats(t *testing.T) {
+	config := &Config{Symbol: "AAPL", NDays: 4, Order: OrderDescending, MaxDays: 100}
+	provider := &MockProvider{
+		DailyBarsFunc: func(ctx context.Context, symbol string, nDays int) ([]TimeSeriesData, error) {
+			return statsBars, nil
+		},
+	}
+	handler := createHandler(config, provider)
+
+	tests := []struct {
+		name     string
+		target   string
+		expected string
+		absent   string
+	}{
+		{"Stats are opt-in", "/", `"average_close":101,`, `"stats"`},
+		{"Selected stats", "/?stats=min_close,total_volume", `"stats":{"min_close":{"date":"2025-01-16","close":98},"total_volume":8000}`, `"vwap"`},
+		{"Stats over the selected window", "/?days=2&stats=change_percent", `"stats":{"change_percent":-3.92}`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			body := recorder.Body.String()
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, recorder.Code, body)
+			}
+			if !strings.Contains(body, tt.expected) {
+				t.Errorf("Expected %s in the response, got %s", tt.expected, body)
+			}
+			if tt.absent != "" && strings.Contains(body, tt.absent) {
+				t.Errorf("Expected no %s in the response, got %s", tt.absent, body)
+			}
+		})
+	}
+}